@@ -1,42 +1,448 @@
 package auth
 
 import (
+	"crypto/subtle"
 	"errors"
 	"fmt"
 	"github.com/gomodule/redigo/redis"
+	"sr/config"
+	"sr/event"
 	"sr/game"
+	"sr/id"
 	"sr/player"
 )
 
 // ErrNotAuthorized is an error for when a user cannot perform an action
 var ErrNotAuthorized = errors.New("not authorized")
 
-// LogPlayerIn checks username/gameID credentials and returns the relevant
-// GameInfo for the client.
+// ErrTooManyAttempts is an error for when a username has had too many wrong
+// passphrases recently to try again.
+var ErrTooManyAttempts = errors.New("too many attempts")
+
+// LogPlayerIn checks username/gameID credentials, and the player's passphrase
+// if they have one, and returns the relevant GameInfo for the client.
 //
 // Returns ErrPlayerNotFound if the username is not found, ErrGameNotFound if
-// the game is not found. These should not be distinguished to users.
-func LogPlayerIn(gameID string, username string, conn redis.Conn) (*game.Info, *player.Player, error) {
+// the game is not found, and ErrNotAuthorized if the passphrase is wrong. These
+// should not be distinguished to users. Returns ErrTooManyAttempts if the
+// username has had too many wrong passphrases.
+func LogPlayerIn(gameID string, username string, passphrase string, conn redis.Conn) (*game.Info, *player.Player, error) {
 	plr, err := player.GetByUsername(username, conn)
 	if errors.Is(err, player.ErrNotFound) {
 		return nil, nil, fmt.Errorf("%w (%v logging into %v)", err, username, gameID)
 	} else if err != nil {
 		return nil, nil, fmt.Errorf("redis error getting %v: %w", username, err)
 	}
+	if err = checkPassphrase(plr, passphrase, conn); err != nil {
+		return nil, nil, err
+	}
+
+	info, err := enterGame(gameID, plr, conn)
+	if err != nil {
+		return nil, nil, err
+	}
+	return info, plr, nil
+}
+
+// SwitchGame checks that a logged in player can enter another of their games,
+// and returns the game's info. The player doesn't need to give credentials
+// again.
+//
+// Returns game.ErrNotFound if the game is not found, and ErrNotAuthorized if
+// the player is not in it or banned from it.
+func SwitchGame(playerID id.UID, gameID string, conn redis.Conn) (*game.Info, *player.Player, error) {
+	plr, err := player.GetByID(string(playerID), conn)
+	if err != nil {
+		return nil, nil, fmt.Errorf("getting player %v: %w", playerID, err)
+	}
+	info, err := enterGame(gameID, plr, conn)
+	if err != nil {
+		return nil, nil, err
+	}
+	return info, plr, nil
+}
 
+// enterGame checks that a player is in a game and not banned from it, and
+// returns the game's info.
+func enterGame(gameID string, plr *player.Player, conn redis.Conn) (*game.Info, error) {
 	info, err := game.GetInfo(gameID, conn)
 	if errors.Is(err, game.ErrNotFound) {
-		return nil, nil, fmt.Errorf("when logging %v in to %v: %w", username, gameID, err)
+		return nil, fmt.Errorf("when logging %v in to %v: %w", plr.Username, gameID, err)
 	} else if err != nil {
-		return nil, nil, fmt.Errorf("redis error fetching game info for %v: %w", gameID, err)
+		return nil, fmt.Errorf("redis error fetching game info for %v: %w", gameID, err)
 	}
 
+	if err = checkNotBanned(gameID, plr, conn); err != nil {
+		return nil, err
+	}
 	// Ensure player is in the game
 	if _, found := info.Players[string(plr.ID)]; !found {
-		return nil, nil, fmt.Errorf(
+		return nil, fmt.Errorf(
 			"%w: player %v (%v) to %v",
-			ErrNotAuthorized, plr.ID, username, gameID,
+			ErrNotAuthorized, plr.ID, plr.Username, gameID,
 		)
 	}
-	return info, plr, nil
+	return info, nil
+}
+
+// ErrAlreadyJoined is an error for when a player asks to join a game they are
+// already in.
+var ErrAlreadyJoined = errors.New("already in game")
+
+// ErrInvalidName is an error for when a new player's username or name is not
+// valid.
+var ErrInvalidName = errors.New("invalid name")
+
+// ErrUsernameTaken is an error for when a new player's username belongs to an
+// existing player who can't be joined as without logging in.
+var ErrUsernameTaken = errors.New("username taken")
+
+// Joining is an invite checked for a player, who is added to the invite's game
+// by FinishJoin.
+type Joining struct {
+	Invite  *game.Invite
+	Player  *player.Player
+	Created bool
+	Joined  bool
+}
+
+// CheckJoin checks that an invite can be used, without using it up. If current
+// is not nil, the logged in player joins. Otherwise, a player is made with the
+// given username and name. An existing username can only be joined as if the
+// player has set a passphrase and it is given.
+//
+// Returns game.ErrInviteNotFound or game.ErrInviteUsedUp if the invite can't be
+// used, ErrInvalidName if a new player's names are invalid, ErrUsernameTaken
+// if the username exists without a passphrase, and ErrNotAuthorized or
+// ErrTooManyAttempts if the passphrase is wrong.
+func CheckJoin(code string, username string, name string, passphrase string, current *player.Player, conn redis.Conn) (*Joining, error) {
+	if current != nil {
+		return checkInvite(code, current, false, conn)
+	}
+	plr, created, err := findOrMakePlayer(username, name, conn)
+	if err != nil {
+		return nil, err
+	}
+	if !created {
+		if err = checkExistingPlayer(plr, passphrase, conn); err != nil {
+			return nil, err
+		}
+	}
+	return checkInvite(code, plr, created, conn)
+}
+
+// checkInvite checks that an invite can be used by a player, and whether they
+// are already in its game.
+func checkInvite(code string, plr *player.Player, created bool, conn redis.Conn) (*Joining, error) {
+	invite, err := game.GetInvite(code, conn)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkNotBanned(invite.GameID, plr, conn); err != nil {
+		return nil, err
+	}
+	joining := &Joining{Invite: invite, Player: plr, Created: created}
+	if !created {
+		_, err = game.GetRole(invite.GameID, plr.ID, conn)
+		if err == nil {
+			joining.Joined = true
+			return joining, nil
+		} else if !errors.Is(err, game.ErrNotInGame) {
+			return nil, err
+		}
+	}
+	if invite.Uses <= 0 {
+		return nil, fmt.Errorf("%w: %v", game.ErrInviteUsedUp, code)
+	}
+	return joining, nil
+}
+
+// FinishJoin redeems a checked invite, adding its player to the invite's game
+// with the invite's role and posting the join to the game, and returns the
+// game's info. Players already in the game don't use up the invite, and the
+// use is given back if the player can't be added.
+func FinishJoin(joining *Joining, conn redis.Conn) (*game.Info, error) {
+	gameID := joining.Invite.GameID
+	if !joining.Joined {
+		if _, err := game.RedeemInvite(joining.Invite.Code, conn); err != nil {
+			return nil, err
+		}
+		if err := addToGame(gameID, joining.Player, joining.Created, joining.Invite.Role, conn); err != nil {
+			if returnErr := game.ReturnInvite(joining.Invite.Code, conn); returnErr != nil {
+				return nil, fmt.Errorf("returning invite after %v: %w", err, returnErr)
+			}
+			return nil, err
+		}
+	}
+	info, err := game.GetInfo(gameID, conn)
+	if err != nil {
+		return nil, fmt.Errorf("redis error fetching game info for %v: %w", gameID, err)
+	}
+	return info, nil
+}
+
+// RequestJoin asks to join a game. If current is not nil, the logged in player
+// asks to join. Otherwise, the player with the given username asks, who is
+// created with the given name if approved and the username is new. An existing
+// username can only be used if the player has set a passphrase and it is given.
+// The player is recorded with the request, so approving it can't add a
+// different player.
+//
+// Returns game.ErrNotFound if the game does not exist or does not allow join
+// requests, which should not be distinguished to users, ErrInvalidName if
+// the names are invalid, ErrUsernameTaken if the username exists without a
+// passphrase, and ErrNotAuthorized or ErrTooManyAttempts if the passphrase is
+// wrong.
+func RequestJoin(gameID string, username string, name string, passphrase string, current *player.Player, conn redis.Conn) (*game.JoinRequest, error) {
+	allowed, err := game.AllowsJoinRequests(gameID, conn)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		return nil, fmt.Errorf("%w: %v does not allow join requests", game.ErrNotFound, gameID)
+	}
+	plr, created := current, false
+	if plr == nil {
+		plr, created, err = findOrMakePlayer(username, name, conn)
+		if err != nil {
+			return nil, err
+		}
+		if !created {
+			if err = checkExistingPlayer(plr, passphrase, conn); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err = checkNotBanned(gameID, plr, conn); err != nil {
+		return nil, err
+	}
+	if created {
+		return game.CreateJoinRequest(gameID, plr.Username, plr.Name, "", conn)
+	}
+	_, err = game.GetRole(gameID, plr.ID, conn)
+	if err == nil {
+		return nil, fmt.Errorf("%w: %v in %v", ErrAlreadyJoined, plr.Username, gameID)
+	} else if !errors.Is(err, game.ErrNotInGame) {
+		return nil, err
+	}
+	return game.CreateJoinRequest(gameID, plr.Username, plr.Name, plr.ID, conn)
+}
+
+// AnswerJoinRequest approves or denies a pending request to join a game.
+// Approved requesters are added to the game as players, and the join is posted
+// to the game. Requests for new players create the player, unless someone
+// else has taken the username since the request was made. The request is put
+// back to pending if the player can't be added.
+//
+// Returns ErrUsernameTaken if the new player's username was taken, and
+// ErrNotAuthorized if the player is banned.
+func AnswerJoinRequest(gameID string, requestID string, approve bool, conn redis.Conn) (*game.JoinRequest, error) {
+	request, err := game.GetJoinRequest(requestID, conn)
+	if err != nil {
+		return nil, err
+	}
+	if request.GameID != gameID {
+		return nil, fmt.Errorf("%w: %v in %v", game.ErrJoinRequestNotFound, requestID, gameID)
+	}
+	if !approve {
+		err = game.AnswerJoinRequest(gameID, requestID, game.JoinStatusDenied, request.PlayerID, conn)
+		if err != nil {
+			return nil, err
+		}
+		request.Status = game.JoinStatusDenied
+		return request, nil
+	}
+
+	var plr *player.Player
+	created := request.PlayerID == ""
+	if created {
+		plr, created, err = findOrMakePlayer(request.Username, request.Name, conn)
+		if err != nil {
+			return nil, err
+		}
+		if !created {
+			return nil, fmt.Errorf("%w: %v since request %v", ErrUsernameTaken, request.Username, requestID)
+		}
+	} else {
+		plr, err = player.GetByID(string(request.PlayerID), conn)
+		if err != nil {
+			return nil, fmt.Errorf("getting requesting player %v: %w", request.PlayerID, err)
+		}
+	}
+	if err = checkNotBanned(gameID, plr, conn); err != nil {
+		return nil, err
+	}
+	err = game.AnswerJoinRequest(gameID, requestID, game.JoinStatusApproved, plr.ID, conn)
+	if err != nil {
+		return nil, err
+	}
+	if err = addToGame(gameID, plr, created, game.RolePlayer, conn); err != nil {
+		if reopenErr := game.ReopenJoinRequest(request, conn); reopenErr != nil {
+			return nil, fmt.Errorf("reopening join request after %v: %w", err, reopenErr)
+		}
+		return nil, err
+	}
+	request.Status = game.JoinStatusApproved
+	request.PlayerID = plr.ID
+	return request, nil
+}
+
+// CheckJoinRequest retrieves a join request for its requester, who must have
+// its token. Approved requests return the game's info and the joined player.
+// Callers remove approved requests with game.RemoveJoinRequest once they've
+// logged in with them, so they can only be used once.
+//
+// Returns game.ErrJoinRequestNotFound if the request does not exist or the
+// token is wrong.
+func CheckJoinRequest(requestID string, token string, conn redis.Conn) (*game.JoinRequest, *game.Info, *player.Player, error) {
+	request, err := game.GetJoinRequest(requestID, conn)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(request.Token), []byte(token)) != 1 {
+		return nil, nil, nil, fmt.Errorf("%w: %v (bad token)", game.ErrJoinRequestNotFound, requestID)
+	}
+	if request.Status != game.JoinStatusApproved {
+		return request, nil, nil, nil
+	}
+
+	plr, err := player.GetByID(string(request.PlayerID), conn)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("getting approved player %v: %w", request.PlayerID, err)
+	}
+	info, err := game.GetInfo(request.GameID, conn)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("redis error fetching game info for %v: %w", request.GameID, err)
+	}
+	return request, info, plr, nil
+}
+
+// findOrMakePlayer retrieves the player with the given username, or makes a
+// new one with the given name if the username is new. New players are not
+// created until they are added to a game.
+func findOrMakePlayer(username string, name string, conn redis.Conn) (*player.Player, bool, error) {
+	plr, err := player.GetByUsername(username, conn)
+	if errors.Is(err, player.ErrNotFound) {
+		if !player.ValidName(username) || !player.ValidName(name) {
+			return nil, false, fmt.Errorf("%w: %v (%v)", ErrInvalidName, username, name)
+		}
+		newPlayer := player.Make(username, name)
+		return &newPlayer, true, nil
+	} else if err != nil {
+		return nil, false, fmt.Errorf("redis error getting %v: %w", username, err)
+	}
+	return plr, false, nil
+}
+
+// ChangePassphrase sets a player's passphrase, or removes it if the new
+// passphrase is empty. Players who have a passphrase must give it as current.
+//
+// Returns ErrNotAuthorized or ErrTooManyAttempts if the current passphrase is
+// wrong.
+func ChangePassphrase(plr *player.Player, current string, passphrase string, conn redis.Conn) error {
+	if err := checkPassphrase(plr, current, conn); err != nil {
+		return err
+	}
+	if passphrase == "" {
+		return player.RemovePassphrase(plr.ID, conn)
+	}
+	return player.SetPassphrase(plr.ID, passphrase, conn)
+}
+
+// checkExistingPlayer checks that someone giving an existing player's username
+// is that player. The player must have set a passphrase, and it must be given.
+func checkExistingPlayer(plr *player.Player, passphrase string, conn redis.Conn) error {
+	has, err := player.HasPassphrase(plr.ID, conn)
+	if err != nil {
+		return err
+	}
+	if !has {
+		return fmt.Errorf("%w: %v has no passphrase", ErrUsernameTaken, plr.Username)
+	}
+	return checkPassphrase(plr, passphrase, conn)
+}
+
+// checkPassphrase checks a player's passphrase, counting wrong passphrases
+// against their username. Returns ErrTooManyAttempts without checking if there
+// have been too many recently, and ErrNotAuthorized if it is wrong.
+func checkPassphrase(plr *player.Player, passphrase string, conn redis.Conn) error {
+	if err := checkFailures(plr, conn); err != nil {
+		return err
+	}
+	err := player.CheckPassphrase(plr.ID, passphrase, conn)
+	if !errors.Is(err, player.ErrWrongPassphrase) {
+		return err
+	}
+	if err = countFailure(plr, conn); err != nil {
+		return err
+	}
+	return fmt.Errorf("%w: wrong passphrase for %v", ErrNotAuthorized, plr.Username)
+}
+
+// checkFailures returns ErrTooManyAttempts if there have been too many wrong
+// passphrases or codes for the player's username recently.
+func checkFailures(plr *player.Player, conn redis.Conn) error {
+	failures, err := redis.Int(conn.Do("GET", "login-failures:"+plr.Username))
+	if err != nil && !errors.Is(err, redis.ErrNil) {
+		return fmt.Errorf("redis error getting login failures of %v: %w", plr.Username, err)
+	}
+	if failures >= config.MaxLoginFailures {
+		return fmt.Errorf("%w: %v failures for %v", ErrTooManyAttempts, failures, plr.Username)
+	}
+	return nil
+}
+
+// countFailure counts a wrong passphrase or code against the player's username.
+// The count is created with its expiry, so it can't be left without one.
+func countFailure(plr *player.Player, conn redis.Conn) error {
+	failuresKey := "login-failures:" + plr.Username
+
+	// MULTI: create count with expiry, increment count
+	if err := conn.Send("MULTI"); err != nil {
+		return fmt.Errorf("redis error sending `MULTI`: %w", err)
+	}
+	if err := conn.Send("SET", failuresKey, 0, "EX", config.LoginFailureWindowSecs, "NX"); err != nil {
+		return fmt.Errorf("redis error sending `SET` login failures: %w", err)
+	}
+	if err := conn.Send("INCR", failuresKey); err != nil {
+		return fmt.Errorf("redis error sending `INCR` login failures: %w", err)
+	}
+	if _, err := conn.Do("EXEC"); err != nil {
+		return fmt.Errorf("redis error counting login failures of %v: %w", plr.Username, err)
+	}
+	return nil
+}
+
+// checkNotBanned returns ErrNotAuthorized if the player is banned from the game.
+func checkNotBanned(gameID string, plr *player.Player, conn redis.Conn) error {
+	banned, err := game.IsBanned(gameID, plr.ID, conn)
+	if err != nil {
+		return err
+	}
+	if banned {
+		return fmt.Errorf("%w: %v (%v) is banned from %v",
+			ErrNotAuthorized, plr.ID, plr.Username, gameID,
+		)
+	}
+	return nil
+}
+
+// addToGame adds a player to a game with a role, creating the player first if
+// it is new, and posts the join to the game.
+func addToGame(gameID string, plr *player.Player, created bool, role game.Role, conn redis.Conn) error {
+	if created {
+		err := player.Create(plr, conn)
+		if errors.Is(err, player.ErrUsernameTaken) {
+			return fmt.Errorf("%w: %v was claimed first", ErrUsernameTaken, plr.Username)
+		} else if err != nil {
+			return fmt.Errorf("creating player %v: %w", plr.Username, err)
+		}
+	}
+	if err := game.AddPlayer(gameID, plr, role, conn); err != nil {
+		return fmt.Errorf("adding %v to %v: %w", plr.ID, gameID, err)
+	}
+	if err := game.PostEvent(gameID, event.ForPlayerJoin(plr), conn); err != nil {
+		return fmt.Errorf("posting join of %v to %v: %w", plr.ID, gameID, err)
+	}
+	return nil
 }
@@ -0,0 +1,229 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"github.com/gomodule/redigo/redis"
+	"sr/config"
+	"sr/game"
+	"sr/id"
+	"sr/oidc"
+	"sr/player"
+)
+
+// ErrOIDCStateNotFound is an error for when an OIDC login was not started, has
+// expired, or was already finished.
+var ErrOIDCStateNotFound = errors.New("oidc login not found")
+
+// ErrIdentityLinked is an error for when an OIDC identity is already linked to
+// a different player.
+var ErrIdentityLinked = errors.New("identity linked to another player")
+
+// ErrOIDCWrongClient is an error for when an OIDC login is finished without the
+// binding returned to the client which started it.
+var ErrOIDCWrongClient = errors.New("oidc login started by another client")
+
+// OIDCLogin is a finished OIDC login. If it linked an identity to a player,
+// GameInfo is nil.
+type OIDCLogin struct {
+	Player   *player.Player
+	GameInfo *game.Info
+	Persist  bool
+}
+
+// oidcState is stored in `oidc-login:{state}` between starting an OIDC login
+// and the provider redirecting back.
+type oidcState struct {
+	Verifier string `redis:"verifier"`
+	Nonce    string `redis:"nonce"`
+	GameID   string `redis:"gameID"`
+	Persist  bool   `redis:"persist"`
+	PlayerID id.UID `redis:"playerID"`
+	Binding  string `redis:"binding"`
+}
+
+// BeginOIDCLogin starts logging in to a game with the OIDC provider, returning
+// the URL to send the player to and the binding the client must give to finish.
+func BeginOIDCLogin(ctx context.Context, gameID string, persist bool, conn redis.Conn) (string, string, error) {
+	return beginOIDC(ctx, oidcState{GameID: gameID, Persist: persist}, conn)
+}
+
+// BeginOIDCLink starts linking the OIDC provider's identity to a player,
+// returning the URL to send the player to and the binding the client must give
+// to finish. A linked identity logs in without a passphrase, so the player
+// must give their current passphrase, and a TOTP or recovery code if they have
+// TOTP enabled.
+//
+// Returns ErrNotAuthorized if either is wrong, and ErrTooManyAttempts without
+// checking if there have been too many wrong attempts recently.
+func BeginOIDCLink(ctx context.Context, plr *player.Player, passphrase string, code string, conn redis.Conn) (string, string, error) {
+	if err := checkPassphrase(plr, passphrase, conn); err != nil {
+		return "", "", err
+	}
+	needed, err := NeedsSecondFactor(plr, conn)
+	if err != nil {
+		return "", "", err
+	}
+	if needed {
+		if err = CheckSecondFactor(plr, code, conn); err != nil {
+			return "", "", err
+		}
+	}
+	return beginOIDC(ctx, oidcState{PlayerID: plr.ID}, conn)
+}
+
+// beginOIDC stores the login's state. The binding is kept by the client which
+// started the login, so a state from someone else's login can't be finished
+// with it.
+func beginOIDC(ctx context.Context, login oidcState, conn redis.Conn) (string, string, error) {
+	state := oidc.RandomString()
+	login.Nonce = oidc.RandomString()
+	login.Binding = oidc.RandomString()
+	verifier, challenge := oidc.NewVerifier()
+	login.Verifier = verifier
+	authURL, err := oidc.AuthURL(ctx, state, login.Nonce, challenge)
+	if err != nil {
+		return "", "", err
+	}
+
+	// MULTI: set state, expire state
+	if err = conn.Send("MULTI"); err != nil {
+		return "", "", fmt.Errorf("redis error sending `MULTI`: %w", err)
+	}
+	if err = conn.Send("HSET", redis.Args{}.Add("oidc-login:"+state).AddFlat(&login)...); err != nil {
+		return "", "", fmt.Errorf("redis error sending `HSET` oidc login: %w", err)
+	}
+	if err = conn.Send("EXPIRE", "oidc-login:"+state, config.OIDCLoginSecs); err != nil {
+		return "", "", fmt.Errorf("redis error sending `EXPIRE` oidc login: %w", err)
+	}
+	if _, err = conn.Do("EXEC"); err != nil {
+		return "", "", fmt.Errorf("redis error sending `EXEC`: %w", err)
+	}
+	return authURL, login.Binding, nil
+}
+
+// FinishOIDC finishes an OIDC login or link with the state and code the
+// provider redirected back with, and the binding of the client which began it.
+//
+// Logins return ErrNotAuthorized if the identity is not linked to a player in
+// the game, and links return ErrIdentityLinked if the identity is linked to
+// another player. Returns ErrOIDCStateNotFound if the state is unknown, and
+// ErrOIDCWrongClient if the binding does not match.
+func FinishOIDC(ctx context.Context, state string, binding string, code string, conn redis.Conn) (*OIDCLogin, error) {
+	// MULTI: get state, delete state so it's only used once
+	if err := conn.Send("MULTI"); err != nil {
+		return nil, fmt.Errorf("redis error sending `MULTI`: %w", err)
+	}
+	if err := conn.Send("HGETALL", "oidc-login:"+state); err != nil {
+		return nil, fmt.Errorf("redis error sending `HGETALL` oidc login: %w", err)
+	}
+	if err := conn.Send("DEL", "oidc-login:"+state); err != nil {
+		return nil, fmt.Errorf("redis error sending `DEL` oidc login: %w", err)
+	}
+	results, err := redis.Values(conn.Do("EXEC"))
+	if err != nil {
+		return nil, fmt.Errorf("redis error sending `EXEC`: %w", err)
+	}
+	data, err := redis.Values(results[0], nil)
+	if err != nil {
+		return nil, fmt.Errorf("redis error getting oidc login: %w", err)
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("%w: %v", ErrOIDCStateNotFound, state)
+	}
+	var login oidcState
+	if err = redis.ScanStruct(data, &login); err != nil {
+		return nil, fmt.Errorf("redis error parsing oidc login: %w", err)
+	}
+	if login.Binding == "" || subtle.ConstantTimeCompare([]byte(binding), []byte(login.Binding)) != 1 {
+		return nil, fmt.Errorf("%w: %v", ErrOIDCWrongClient, state)
+	}
+
+	identity, err := oidc.Exchange(ctx, code, login.Verifier)
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(identity.Nonce), []byte(login.Nonce)) != 1 {
+		return nil, fmt.Errorf("%w: nonce mismatch", oidc.ErrInvalidToken)
+	}
+
+	if login.PlayerID != "" {
+		return linkIdentity(identity, login.PlayerID, conn)
+	}
+
+	playerID, err := redis.String(conn.Do("HGET", "oidc-identities", identity.Key()))
+	if errors.Is(err, redis.ErrNil) {
+		return nil, fmt.Errorf("%w: %v is not linked", ErrNotAuthorized, identity.Key())
+	} else if err != nil {
+		return nil, fmt.Errorf("redis error getting oidc identity: %w", err)
+	}
+	plr, err := player.GetByID(playerID, conn)
+	if err != nil {
+		return nil, fmt.Errorf("getting player %v of %v: %w", playerID, identity.Key(), err)
+	}
+	info, err := enterGame(login.GameID, plr, conn)
+	if err != nil {
+		return nil, err
+	}
+	return &OIDCLogin{Player: plr, GameInfo: info, Persist: login.Persist}, nil
+}
+
+// linkIdentity links an OIDC identity to a player, replacing the player's
+// previous identity.
+func linkIdentity(identity *oidc.Identity, playerID id.UID, conn redis.Conn) (*OIDCLogin, error) {
+	plr, err := player.GetByID(string(playerID), conn)
+	if err != nil {
+		return nil, fmt.Errorf("getting player %v to link: %w", playerID, err)
+	}
+	linked, err := redis.String(conn.Do("HGET", "oidc-identities", identity.Key()))
+	if err == nil && linked != string(playerID) {
+		return nil, fmt.Errorf("%w: %v to %v", ErrIdentityLinked, identity.Key(), linked)
+	} else if err != nil && !errors.Is(err, redis.ErrNil) {
+		return nil, fmt.Errorf("redis error getting oidc identity: %w", err)
+	}
+	if err = UnlinkOIDC(playerID, conn); err != nil {
+		return nil, err
+	}
+
+	// MULTI: link identity to player, player to identity
+	if err = conn.Send("MULTI"); err != nil {
+		return nil, fmt.Errorf("redis error sending `MULTI`: %w", err)
+	}
+	if err = conn.Send("HSET", "oidc-identities", identity.Key(), playerID); err != nil {
+		return nil, fmt.Errorf("redis error sending `HSET` oidc identity: %w", err)
+	}
+	if err = conn.Send("HSET", "player:"+string(playerID), "oidc", identity.Key()); err != nil {
+		return nil, fmt.Errorf("redis error sending `HSET` player oidc: %w", err)
+	}
+	if _, err = conn.Do("EXEC"); err != nil {
+		return nil, fmt.Errorf("redis error sending `EXEC`: %w", err)
+	}
+	return &OIDCLogin{Player: plr}, nil
+}
+
+// UnlinkOIDC removes the OIDC identity linked to a player, if there is one.
+func UnlinkOIDC(playerID id.UID, conn redis.Conn) error {
+	key, err := redis.String(conn.Do("HGET", "player:"+string(playerID), "oidc"))
+	if errors.Is(err, redis.ErrNil) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("redis error getting player oidc: %w", err)
+	}
+
+	// MULTI: unlink identity, unlink player
+	if err = conn.Send("MULTI"); err != nil {
+		return fmt.Errorf("redis error sending `MULTI`: %w", err)
+	}
+	if err = conn.Send("HDEL", "oidc-identities", key); err != nil {
+		return fmt.Errorf("redis error sending `HDEL` oidc identity: %w", err)
+	}
+	if err = conn.Send("HDEL", "player:"+string(playerID), "oidc"); err != nil {
+		return fmt.Errorf("redis error sending `HDEL` player oidc: %w", err)
+	}
+	if _, err = conn.Do("EXEC"); err != nil {
+		return fmt.Errorf("redis error sending `EXEC`: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gomodule/redigo/redis"
+	"sr/config"
+	"sr/game"
+	"sr/id"
+	"sr/player"
+)
+
+// ErrChallengeNotFound is an error for when a second factor challenge does not
+// exist, has expired, or was already used.
+var ErrChallengeNotFound = errors.New("login challenge not found")
+
+// loginChallenge is stored in `login-challenge:{challenge}` between a player
+// passing their first factor and their second. Players joining with an invite
+// redeem it after their second factor.
+type loginChallenge struct {
+	PlayerID id.UID `redis:"playerID"`
+	GameID   string `redis:"gameID"`
+	Invite   string `redis:"invite"`
+	Persist  bool   `redis:"persist"`
+}
+
+// NeedsSecondFactor determines if a player must give a second factor before
+// getting a session.
+func NeedsSecondFactor(plr *player.Player, conn redis.Conn) (bool, error) {
+	return player.HasTOTP(plr.ID, conn)
+}
+
+// BeginSecondFactor records that a player passed their first factor logging
+// in to a game, or joining it with an invite if one is given, returning a
+// challenge to give with their second factor.
+func BeginSecondFactor(plr *player.Player, gameID string, invite string, persist bool, conn redis.Conn) (string, error) {
+	challenge := string(id.GenSessionID())
+	login := loginChallenge{PlayerID: plr.ID, GameID: gameID, Invite: invite, Persist: persist}
+
+	// MULTI: set challenge, expire challenge
+	if err := conn.Send("MULTI"); err != nil {
+		return "", fmt.Errorf("redis error sending `MULTI`: %w", err)
+	}
+	if err := conn.Send("HSET", redis.Args{}.Add("login-challenge:"+challenge).AddFlat(&login)...); err != nil {
+		return "", fmt.Errorf("redis error sending `HSET` login challenge: %w", err)
+	}
+	if err := conn.Send("EXPIRE", "login-challenge:"+challenge, config.SecondFactorSecs); err != nil {
+		return "", fmt.Errorf("redis error sending `EXPIRE` login challenge: %w", err)
+	}
+	if _, err := conn.Do("EXEC"); err != nil {
+		return "", fmt.Errorf("redis error sending `EXEC`: %w", err)
+	}
+	return challenge, nil
+}
+
+// FinishSecondFactor checks a player's TOTP or recovery code for a challenge,
+// joins the game if the challenge has an invite, and returns the game's info,
+// the player and whether the session persists. The challenge can only be
+// finished once.
+//
+// Returns ErrChallengeNotFound if the challenge is unknown, ErrNotAuthorized
+// or ErrTooManyAttempts if the code is wrong, and game.ErrInviteNotFound or
+// game.ErrInviteUsedUp if the invite can no longer be used.
+func FinishSecondFactor(challenge string, code string, conn redis.Conn) (*game.Info, *player.Player, bool, error) {
+	data, err := redis.Values(conn.Do("HGETALL", "login-challenge:"+challenge))
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("redis error getting login challenge: %w", err)
+	}
+	if len(data) == 0 {
+		return nil, nil, false, fmt.Errorf("%w: %v", ErrChallengeNotFound, challenge)
+	}
+	var login loginChallenge
+	if err = redis.ScanStruct(data, &login); err != nil {
+		return nil, nil, false, fmt.Errorf("redis error parsing login challenge: %w", err)
+	}
+	plr, err := player.GetByID(string(login.PlayerID), conn)
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("getting player %v of challenge: %w", login.PlayerID, err)
+	}
+	if err = CheckSecondFactor(plr, code, conn); err != nil {
+		return nil, nil, false, err
+	}
+
+	removed, err := redis.Int(conn.Do("DEL", "login-challenge:"+challenge))
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("redis error deleting login challenge: %w", err)
+	}
+	if removed != 1 {
+		return nil, nil, false, fmt.Errorf("%w: %v already used", ErrChallengeNotFound, challenge)
+	}
+	if login.Invite != "" {
+		joining, err := checkInvite(login.Invite, plr, false, conn)
+		if err != nil {
+			return nil, nil, false, err
+		}
+		info, err := FinishJoin(joining, conn)
+		if err != nil {
+			return nil, nil, false, err
+		}
+		return info, plr, login.Persist, nil
+	}
+	info, err := enterGame(login.GameID, plr, conn)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	return info, plr, login.Persist, nil
+}
+
+// CheckSecondFactor checks a player's TOTP or recovery code, counting wrong
+// codes against their username like wrong passphrases.
+//
+// Returns ErrNotAuthorized if the code is wrong, and ErrTooManyAttempts without
+// checking if there have been too many wrong attempts recently.
+func CheckSecondFactor(plr *player.Player, code string, conn redis.Conn) error {
+	if err := checkFailures(plr, conn); err != nil {
+		return err
+	}
+	err := player.CheckSecondFactor(plr.ID, code, conn)
+	if !errors.Is(err, player.ErrWrongCode) {
+		return err
+	}
+	if err = countFailure(plr, conn); err != nil {
+		return err
+	}
+	return fmt.Errorf("%w: wrong code for %v", ErrNotAuthorized, plr.Username)
+}
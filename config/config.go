@@ -175,6 +175,16 @@ var (
 	// SSEPingSecs is the amount of time between SSE pings.
 	// Lack of SSE pings may cause the browser to close the SSE connection.
 	SSEPingSecs = readInt("SSE_PING_SECS", 15)
+	// PresenceSecs is how long a player is shown as connected to a game after
+	// their subscription's last heartbeat, which is sent with each SSE ping.
+	// Players of a crashed server are shown as offline after this.
+	PresenceSecs = readInt("PRESENCE_SECS", 45)
+	// AwaySecs is how long a connected player can be inactive in a game before
+	// they're shown as away.
+	AwaySecs = readInt("AWAY_SECS", 300)
+	// ActivitySecs is how long a player is shown as typing or rolling after
+	// they last said so.
+	ActivitySecs = readInt("ACTIVITY_SECS", 10)
 	// MaxHeaderBytes is the maximum number of header bytes which can be read by
 	// the Go server.
 	MaxHeaderBytes = readInt("MAX_HEADER_BYTES", 1<<20)
@@ -228,10 +238,74 @@ var (
 	HardcodedUsernames = readStringArray("USERNAMES", "snirk,smark,smirk")
 	// RollBufferSize is the size of the channel buffer from the roll goroutine.
 	RollBufferSize = readInt("ROLL_BUFFER_SIZE", 200)
+	// RollFairnessWindow is the number of recent dice checked for fairness.
+	RollFairnessWindow = readInt("ROLL_FAIRNESS_WINDOW", 6000)
+	// RollFairnessInterval is the number of dice rolled between fairness checks.
+	RollFairnessInterval = readInt("ROLL_FAIRNESS_INTERVAL", 1000)
+	// RollFairnessAlertOdds is how unlikely (1 in N) a fair die would have to be
+	// to produce the window for a fairness check to alert.
+	RollFairnessAlertOdds = readInt("ROLL_FAIRNESS_ALERT_ODDS", 10000)
 	// MaxSingleRoll is the largest roll request the server will handle at once.
 	MaxSingleRoll = readInt("MAX_SINGLE_ROLL", 100)
 	// MaxEventRange is the largest range of events the server will provide at once.
 	MaxEventRange = readInt("MAX_EVENT_RANGE", 50)
+	// MaxChatLength is the most characters allowed in a chat message.
+	MaxChatLength = readInt("MAX_CHAT_LENGTH", 1000)
+	// MaxChatLines is the most lines allowed in a chat message.
+	MaxChatLines = readInt("MAX_CHAT_LINES", 12)
+	// MaxCommentLength is the most characters allowed in a comment on an event.
+	MaxCommentLength = readInt("MAX_COMMENT_LENGTH", 200)
+	// MaxEventComments is the most comments allowed on a single event.
+	MaxEventComments = readInt("MAX_EVENT_COMMENTS", 50)
+	// TrashRetentionHours is how long deleted events can be restored.
+	TrashRetentionHours = readInt("TRASH_RETENTION_HOURS", 7*24)
+	// MaxInviteUses is the most players who can join with one invite code.
+	MaxInviteUses = readInt("MAX_INVITE_USES", 100)
+	// MaxInviteHours is the longest an invite code can last.
+	MaxInviteHours = readInt("MAX_INVITE_HOURS", 14*24)
+	// DefaultInviteUses is the number of uses of the invite for a new game.
+	DefaultInviteUses = readInt("DEFAULT_INVITE_USES", 10)
+	// DefaultInviteHours is how long the invite for a new game lasts.
+	DefaultInviteHours = readInt("DEFAULT_INVITE_HOURS", 7*24)
+	// JoinRequestHours is how long a request to join a game lasts unanswered.
+	JoinRequestHours = readInt("JOIN_REQUEST_HOURS", 2*24)
+	// MaxJoinRequests is the most pending requests to join one game.
+	MaxJoinRequests = readInt("MAX_JOIN_REQUESTS", 50)
+	// MinPassphraseLength is the fewest characters in a player's passphrase.
+	MinPassphraseLength = readInt("MIN_PASSPHRASE_LENGTH", 8)
+	// PassphraseHashCost is the bcrypt cost of hashing passphrases.
+	PassphraseHashCost = readInt("PASSPHRASE_HASH_COST", 12)
+	// MaxLoginFailures is the number of wrong passphrases for a username
+	// before logging in as it is refused for LoginFailureWindowSecs.
+	MaxLoginFailures = readInt("MAX_LOGIN_FAILURES", 5)
+	// LoginFailureWindowSecs is how long wrong passphrases are counted.
+	LoginFailureWindowSecs = readInt("LOGIN_FAILURE_WINDOW_SECS", 15*60)
+	// TOTPIssuer is the account issuer shown in players' authenticator apps.
+	TOTPIssuer = readString("TOTP_ISSUER", "Shadowroller")
+	// RecoveryCodeCount is the number of recovery codes players get with TOTP.
+	RecoveryCodeCount = readInt("RECOVERY_CODE_COUNT", 10)
+	// SecondFactorSecs is how long a player has to give their second factor
+	// after their first when logging in.
+	SecondFactorSecs = readInt("SECOND_FACTOR_SECS", 5*60)
+
+	// OpenID Connect options
+
+	// OIDCIssuer is the issuer URL of an OpenID Connect provider players can
+	// log in with. Its discovery document is read from
+	// `{issuer}/.well-known/openid-configuration`. Leave blank to disable.
+	OIDCIssuer = readString("OIDC_ISSUER", "")
+	// OIDCClientID is the client ID registered with the OIDC provider.
+	OIDCClientID = readString("OIDC_CLIENT_ID", "")
+	// OIDCClientSecret is the client secret registered with the OIDC provider,
+	// if it gave one. PKCE is used either way.
+	OIDCClientSecret = readString("OIDC_CLIENT_SECRET", "")
+	// OIDCRedirectURL is the frontend page the OIDC provider redirects to,
+	// which sends the code and state to /auth/oidc/finish.
+	OIDCRedirectURL = readString("OIDC_REDIRECT_URL", "http://localhost:3000/oidc-callback")
+	// OIDCScopes are the scopes requested from the OIDC provider.
+	OIDCScopes = readString("OIDC_SCOPES", "openid profile")
+	// OIDCLoginSecs is how long a player has to finish logging in with OIDC.
+	OIDCLoginSecs = readInt("OIDC_LOGIN_SECS", 10*60)
 )
 
 func readString(name string, defaultValue string) string {
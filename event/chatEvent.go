@@ -0,0 +1,49 @@
+package event
+
+import (
+	"regexp"
+	"sr/config"
+	"sr/player"
+	"strings"
+	"unicode/utf8"
+)
+
+// EventTypeChat is the type of `Chat` events.
+const EventTypeChat = "chat"
+
+// Chat is a message sent by a player to the game.
+type Chat struct {
+	core
+	Text string `json:"text"`
+}
+
+// ForChat makes a Chat event.
+func ForChat(player *player.Player, share Share, text string) Chat {
+	return Chat{
+		core: makeCore(EventTypeChat, player, share),
+		Text: text,
+	}
+}
+
+// Chat messages may use inline Markdown (emphasis, code, links), but not
+// block-level syntax. These patterns match block syntax at the start of a line.
+var chatBlockMarkdown = regexp.MustCompile(`(?m)^(\s*)(#|>|\x60\x60\x60|~~~|={3,}|-{3,})`)
+var chatImageMarkdown = regexp.MustCompile(`!\[`)
+var chatHTML = regexp.MustCompile(`<`)
+
+// LimitChatText trims and escapes a chat message so only inline Markdown
+// is rendered. It returns false if the message is empty, too long, or has
+// too many lines.
+func LimitChatText(text string) (string, bool) {
+	text = strings.TrimSpace(strings.ReplaceAll(text, "\r\n", "\n"))
+	if text == "" || utf8.RuneCountInString(text) > config.MaxChatLength {
+		return "", false
+	}
+	if strings.Count(text, "\n") >= config.MaxChatLines {
+		return "", false
+	}
+	text = chatBlockMarkdown.ReplaceAllString(text, `$1\$2`)
+	text = chatImageMarkdown.ReplaceAllString(text, `!\[`)
+	text = chatHTML.ReplaceAllString(text, `\<`)
+	return text, true
+}
@@ -30,6 +30,22 @@ func GetByID(gameID string, eventID int64, conn redis.Conn) (string, error) {
 	return events[0], nil
 }
 
+// RevisionsKey is the key of the list of previous versions of an event.
+func RevisionsKey(gameID string, eventID int64) string {
+	return fmt.Sprintf("revisions:%v:%v", gameID, eventID)
+}
+
+// GetRevisions retrieves the previous versions of an event, oldest first.
+func GetRevisions(gameID string, eventID int64, conn redis.Conn) ([]string, error) {
+	revisions, err := redis.Strings(conn.Do(
+		"LRANGE", RevisionsKey(gameID, eventID), 0, -1,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("redis error getting revisions of %v: %w", eventID, err)
+	}
+	return revisions, nil
+}
+
 // GetLatest retrieves the latest count history events for the given game.
 func GetLatest(gameID string, count int, conn redis.Conn) ([]string, error) {
 	return GetOlderThan(gameID, "+inf", count, conn)
@@ -45,16 +61,31 @@ func GetBetween(gameID string, newest string, oldest string, count int, conn red
 	events, err := redis.Strings(conn.Do(
 		"ZREVRANGEBYSCORE",
 		"history:"+gameID,
-		newest, "-inf",
+		newest, oldest,
 		"LIMIT", "0", count,
 	))
 	if err != nil {
-		return nil, fmt.Errorf("Redis error finding events older than %v: %w", newest, err)
+		return nil, fmt.Errorf("Redis error finding events between %v and %v: %w", newest, oldest, err)
 	}
 
 	return events, nil
 }
 
+// GetNewerThan returns up to count events newer than the given oldest ID, in
+// chronological order. Prefix oldest with `(` to exclude it from the results.
+func GetNewerThan(gameID string, oldest string, count int, conn redis.Conn) ([]string, error) {
+	events, err := redis.Strings(conn.Do(
+		"ZRANGEBYSCORE",
+		"history:"+gameID,
+		oldest, "+inf",
+		"LIMIT", "0", count,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("redis error finding events newer than %v: %w", oldest, err)
+	}
+	return events, nil
+}
+
 // BulkUpdate updates all of the given events at once
 func BulkUpdate(gameID string, events []Event, conn redis.Conn) error {
 	if err := conn.Send("MULTI"); err != nil {
@@ -19,16 +19,30 @@ type Event interface {
 	GetPlayerName() string
 	GetEdit() int64
 	SetEdit(edited int64)
+	GetRevs() int
+	SetRevs(revs int)
+	GetScene() int64
+	SetScene(scene int64)
+	GetReactions() map[string][]id.UID
+	SetReaction(emoji string, playerID id.UID, reacted bool) bool
+	GetComments() []Comment
+	AddComment(comment Comment) error
+	RemoveComment(commentID int64, playerID id.UID) error
 }
 
 // core is the basic values put into events.
 type core struct {
-	ID         int64  `json:"id"`             // ID of the event
-	Type       string `json:"ty"`             // Type of the event
-	Edit       int64  `json:"edit,omitempty"` // Edit time of the event
-	Share      int    `json:"share"`          // share state of the event
-	PlayerID   id.UID `json:"pID"`            // ID of the player who posted the event
-	PlayerName string `json:"pName"`          // Name of the player who posted the event
+	ID         int64  `json:"id"`              // ID of the event
+	Type       string `json:"ty"`              // Type of the event
+	Edit       int64  `json:"edit,omitempty"`  // Edit time of the event
+	Revs       int    `json:"revs,omitempty"`  // Number of previous versions of the event
+	Scene      int64  `json:"scene,omitempty"` // ID of the scene the event was posted in
+	Share      int    `json:"share"`           // share state of the event
+	PlayerID   id.UID `json:"pID"`             // ID of the player who posted the event
+	PlayerName string `json:"pName"`           // Name of the player who posted the event
+
+	Reactions map[string][]id.UID `json:"reactions,omitempty"` // Players who reacted with each emoji
+	Comments  []Comment           `json:"comments,omitempty"`  // Comments left on the event
 }
 
 // GetID returns the timestamp ID of the event.
@@ -72,6 +86,26 @@ func (c *core) SetEdit(edited int64) {
 	c.Edit = edited
 }
 
+// GetRevs gets the number of previous versions of the event
+func (c *core) GetRevs() int {
+	return c.Revs
+}
+
+// SetRevs sets the number of previous versions of the event
+func (c *core) SetRevs(revs int) {
+	c.Revs = revs
+}
+
+// GetScene gets the ID of the scene the event was posted in
+func (c *core) GetScene() int64 {
+	return c.Scene
+}
+
+// SetScene sets the ID of the scene the event was posted in
+func (c *core) SetScene(scene int64) {
+	c.Scene = scene
+}
+
 // Parse parses an event from JSON
 func Parse(input []byte) (Event, error) {
 	var data map[string]interface{}
@@ -109,6 +143,21 @@ func Parse(input []byte) (Event, error) {
 		err = json.Unmarshal(input, &initiativeRoll)
 		return &initiativeRoll, err
 
+	case EventTypeChat:
+		var chat Chat
+		err = json.Unmarshal(input, &chat)
+		return &chat, err
+
+	case EventTypeSceneStart:
+		var sceneStart SceneStart
+		err = json.Unmarshal(input, &sceneStart)
+		return &sceneStart, err
+
+	case EventTypeSceneEnd:
+		var sceneEnd SceneEnd
+		err = json.Unmarshal(input, &sceneEnd)
+		return &sceneEnd, err
+
 	case EventTypePlayerJoin:
 		var playerJoin PlayerJoin
 		err = json.Unmarshal(input, &playerJoin)
@@ -0,0 +1,115 @@
+package event
+
+import (
+	"errors"
+	"sr/config"
+	"sr/id"
+	"sr/player"
+	"strings"
+	"unicode/utf8"
+)
+
+// Reactions are the emoji players may react to events with.
+var Reactions = []string{"👍", "👎", "😂", "😮", "😱", "💀", "🔥", "🎲"}
+
+// ValidReaction determines if the emoji is one players may react with.
+func ValidReaction(emoji string) bool {
+	for _, reaction := range Reactions {
+		if reaction == emoji {
+			return true
+		}
+	}
+	return false
+}
+
+// Comment is a short message left on an event.
+type Comment struct {
+	ID         int64  `json:"id"`
+	PlayerID   id.UID `json:"pID"`
+	PlayerName string `json:"pName"`
+	Text       string `json:"text"`
+}
+
+// ForComment makes a Comment by the given player.
+func ForComment(player *player.Player, text string) Comment {
+	return Comment{
+		ID:         id.NewEventID(),
+		PlayerID:   player.ID,
+		PlayerName: player.Name,
+		Text:       text,
+	}
+}
+
+// ErrTooManyComments means an event has the maximum number of comments.
+var ErrTooManyComments = errors.New("too many comments")
+
+// ErrCommentNotFound means a comment was not found on an event.
+var ErrCommentNotFound = errors.New("comment not found")
+
+// ValidCommentText trims a comment's text and determines if it is valid.
+// Comments are a single line of up to `config.MaxCommentLength` characters.
+func ValidCommentText(text string) (string, bool) {
+	text = strings.TrimSpace(text)
+	return text, text != "" &&
+		utf8.RuneCountInString(text) <= config.MaxCommentLength &&
+		!strings.ContainsAny(text, "\r\n")
+}
+
+// GetReactions gets the players who reacted to the event with each emoji
+func (c *core) GetReactions() map[string][]id.UID {
+	return c.Reactions
+}
+
+// SetReaction adds or removes a player's reaction to the event.
+// Returns whether the event's reactions changed.
+func (c *core) SetReaction(emoji string, playerID id.UID, reacted bool) bool {
+	players := c.Reactions[emoji]
+	for i, found := range players {
+		if found != playerID {
+			continue
+		}
+		if reacted {
+			return false
+		}
+		players = append(players[:i], players[i+1:]...)
+		if len(players) == 0 {
+			delete(c.Reactions, emoji)
+		} else {
+			c.Reactions[emoji] = players
+		}
+		return true
+	}
+	if !reacted {
+		return false
+	}
+	if c.Reactions == nil {
+		c.Reactions = make(map[string][]id.UID)
+	}
+	c.Reactions[emoji] = append(players, playerID)
+	return true
+}
+
+// GetComments gets the comments left on the event, oldest first
+func (c *core) GetComments() []Comment {
+	return c.Comments
+}
+
+// AddComment adds a comment to the event
+func (c *core) AddComment(comment Comment) error {
+	if len(c.Comments) >= config.MaxEventComments {
+		return ErrTooManyComments
+	}
+	c.Comments = append(c.Comments, comment)
+	return nil
+}
+
+// RemoveComment removes the given player's comment from the event
+func (c *core) RemoveComment(commentID int64, playerID id.UID) error {
+	for i, comment := range c.Comments {
+		if comment.ID == commentID && comment.PlayerID == playerID {
+			c.Comments = append(c.Comments[:i], c.Comments[i+1:]...)
+			return nil
+		}
+	}
+	return ErrCommentNotFound
+}
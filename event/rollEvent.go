@@ -1,6 +1,7 @@
 package event
 
 import (
+	"sr"
 	"sr/player"
 )
 
@@ -13,6 +14,7 @@ type Roll struct {
 	Title   string `json:"title"`
 	Dice    []int  `json:"dice"`
 	Glitchy int    `json:"glitchy"`
+	Reroll  []int  `json:"reroll,omitempty"` // Misses rerolled with Second Chance
 }
 
 // ForRoll makes a RollEvent.
@@ -49,8 +51,9 @@ func ForEdgeRoll(player *player.Player, share Share, title string, rounds [][]in
 // EventTypeReroll is the type of `Reroll` events.
 const EventTypeReroll = "rerollFailures"
 
-// Reroll is triggered when a player uses edge for Second Chance
-// on a roll.
+// Reroll was triggered when a player used edge for Second Chance
+// on a roll. Second Chance now sets `Roll.Reroll` instead; this type
+// remains for events already in games' histories.
 type Reroll struct {
 	core
 	PrevID  int64   `json:"prevID"`
@@ -69,3 +72,38 @@ func ForReroll(player *player.Player, previous *Roll, rounds [][]int) Reroll {
 		Glitchy: previous.Glitchy,
 	}
 }
+
+// FinalDice gives the dice and glitchy value of dice pool rolls after any
+// Second Chance has been applied. ok is false for events which are not rolls.
+func FinalDice(evt Event) (dice []int, glitchy int, ok bool) {
+	switch evt.(type) {
+	case *Roll:
+		roll := evt.(*Roll)
+		if len(roll.Reroll) != 0 {
+			return keepHits(roll.Dice, roll.Reroll), roll.Glitchy, true
+		}
+		return roll.Dice, roll.Glitchy, true
+	case *EdgeRoll:
+		edgeRoll := evt.(*EdgeRoll)
+		return sr.FlattenRounds(edgeRoll.Rounds), edgeRoll.Glitchy, true
+	case *Reroll:
+		reroll := evt.(*Reroll)
+		// Rounds are [rerolled, original]
+		original := reroll.Rounds[len(reroll.Rounds)-1]
+		return keepHits(original, reroll.Rounds[0]), reroll.Glitchy, true
+	default:
+		return nil, 0, false
+	}
+}
+
+// keepHits gives the dice of a Second Chance roll: the original hits are
+// kept, and the misses are replaced by the rerolled dice.
+func keepHits(original []int, rerolled []int) []int {
+	var dice []int
+	for _, die := range original {
+		if die >= 5 {
+			dice = append(dice, die)
+		}
+	}
+	return append(dice, rerolled...)
+}
@@ -0,0 +1,68 @@
+package event
+
+import (
+	"sr/player"
+	"strings"
+	"unicode/utf8"
+)
+
+// EventTypeSceneStart is the type of `SceneStart` events.
+const EventTypeSceneStart = "sceneStart"
+
+// SceneStart is triggered when a scene begins in a game.
+// The ID of the event is the ID of the scene.
+type SceneStart struct {
+	core
+	Title string `json:"title"`
+}
+
+// ForSceneStart makes a SceneStart event. The event is tagged with its own scene.
+func ForSceneStart(player *player.Player, title string) SceneStart {
+	start := SceneStart{
+		core:  makeCore(EventTypeSceneStart, player, ShareInGame),
+		Title: title,
+	}
+	start.Scene = start.ID
+	return start
+}
+
+// EventTypeSceneEnd is the type of `SceneEnd` events.
+const EventTypeSceneEnd = "sceneEnd"
+
+// SceneEnd is triggered when a scene ends in a game.
+type SceneEnd struct {
+	core
+	Title string `json:"title"`
+}
+
+// ForSceneEnd makes a SceneEnd event for the given scene.
+func ForSceneEnd(player *player.Player, sceneID int64, title string) SceneEnd {
+	end := SceneEnd{
+		core:  makeCore(EventTypeSceneEnd, player, ShareInGame),
+		Title: title,
+	}
+	end.Scene = sceneID
+	return end
+}
+
+// IsModifiable determines if players may edit, reshare, or delete an event.
+// Events which record changes to the game itself may not be modified.
+func IsModifiable(evt Event) bool {
+	switch evt.GetType() {
+	case EventTypePlayerJoin, EventTypeSceneStart, EventTypeSceneEnd:
+		return false
+	default:
+		return true
+	}
+}
+
+// maxSceneTitleLength is the longest title allowed for a scene.
+const maxSceneTitleLength = 100
+
+// ValidSceneTitle determines if a scene title is non-empty, short, and on a
+// single line.
+func ValidSceneTitle(title string) bool {
+	return strings.TrimSpace(title) != "" &&
+		utf8.RuneCountInString(title) <= maxSceneTitleLength &&
+		!strings.ContainsAny(title, "\r\n")
+}
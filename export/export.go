@@ -0,0 +1,242 @@
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sr"
+	"sr/event"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// Format is the output format of a game export.
+type Format string
+
+// FormatJSON exports one event per line as JSON (JSON Lines).
+const FormatJSON = Format("json")
+
+// FormatCSV exports one row per roll, with hits and glitches.
+const FormatCSV = Format("csv")
+
+// FormatMarkdown exports a readable transcript of the game.
+const FormatMarkdown = Format("md")
+
+// ErrInvalidFormat means an unknown export format was requested.
+var ErrInvalidFormat = errors.New("invalid export format")
+
+// ParseFormat parses an export format from a string.
+func ParseFormat(format string) (Format, bool) {
+	switch Format(format) {
+	case FormatJSON, FormatCSV, FormatMarkdown:
+		return Format(format), true
+	default:
+		return "", false
+	}
+}
+
+// ContentType is the MIME type of the export format.
+func (f Format) ContentType() string {
+	switch f {
+	case FormatJSON:
+		return "application/x-ndjson"
+	case FormatCSV:
+		return "text/csv"
+	default:
+		return "text/markdown"
+	}
+}
+
+// Extension is the file extension of the export format.
+func (f Format) Extension() string {
+	switch f {
+	case FormatJSON:
+		return "jsonl"
+	case FormatCSV:
+		return "csv"
+	default:
+		return "md"
+	}
+}
+
+// bufferSize is the number of events read from redis at once.
+const bufferSize = 200
+
+// Filter decides whether an event is included in an export.
+type Filter func(evt event.Event) bool
+
+// Game writes the full history of a game to out, oldest event first.
+// Events which do not pass filter are skipped; a nil filter includes all events.
+func Game(gameID string, format Format, out io.Writer, filter Filter, conn redis.Conn) error {
+	var writer writer
+	switch format {
+	case FormatJSON:
+		writer = &jsonWriter{out: out}
+	case FormatCSV:
+		writer = &csvWriter{out: csv.NewWriter(out)}
+	case FormatMarkdown:
+		writer = &markdownWriter{out: out}
+	default:
+		return fmt.Errorf("%w: %v", ErrInvalidFormat, format)
+	}
+
+	if err := writer.begin(gameID); err != nil {
+		return fmt.Errorf("writing %v header: %w", format, err)
+	}
+	oldest := "-inf"
+	for {
+		events, err := event.GetNewerThan(gameID, oldest, bufferSize, conn)
+		if err != nil {
+			return fmt.Errorf("getting events newer than %v: %w", oldest, err)
+		}
+		for i, eventText := range events {
+			evt, err := event.Parse([]byte(eventText))
+			if err != nil {
+				return fmt.Errorf("parsing event #%v, %v: %w", i, eventText, err)
+			}
+			oldest = fmt.Sprintf("(%v", evt.GetID())
+			if filter != nil && !filter(evt) {
+				continue
+			}
+			if err = writer.write(evt); err != nil {
+				return fmt.Errorf("writing event %v: %w", evt.GetID(), err)
+			}
+		}
+		if len(events) < bufferSize {
+			break
+		}
+	}
+	if err := writer.end(); err != nil {
+		return fmt.Errorf("finishing %v export: %w", format, err)
+	}
+	return nil
+}
+
+// writer writes events in a specific export format.
+type writer interface {
+	begin(gameID string) error
+	write(evt event.Event) error
+	end() error
+}
+
+// eventTime converts an event ID to the time it was posted.
+func eventTime(evt event.Event) time.Time {
+	return time.Unix(0, evt.GetID()*int64(time.Millisecond)).UTC()
+}
+
+type jsonWriter struct {
+	out io.Writer
+}
+
+func (w *jsonWriter) begin(gameID string) error {
+	return nil
+}
+
+func (w *jsonWriter) write(evt event.Event) error {
+	bytes, err := json.Marshal(evt)
+	if err != nil {
+		return fmt.Errorf("marshaling event to JSON: %w", err)
+	}
+	_, err = w.out.Write(append(bytes, '\n'))
+	return err
+}
+
+func (w *jsonWriter) end() error {
+	return nil
+}
+
+type csvWriter struct {
+	out *csv.Writer
+}
+
+var csvHeader = []string{
+	"id", "time", "type", "playerID", "playerName", "share",
+	"title", "dice", "hits", "glitch", "criticalGlitch",
+}
+
+func (w *csvWriter) begin(gameID string) error {
+	return w.out.Write(csvHeader)
+}
+
+func (w *csvWriter) write(evt event.Event) error {
+	dice, glitchy, ok := event.FinalDice(evt)
+	if !ok {
+		return nil
+	}
+	diceText := make([]string, len(dice))
+	for i, die := range dice {
+		diceText[i] = strconv.Itoa(die)
+	}
+	title := eventTitle(evt)
+	return w.out.Write([]string{
+		strconv.FormatInt(evt.GetID(), 10),
+		eventTime(evt).Format(time.RFC3339),
+		evt.GetType(),
+		string(evt.GetPlayerID()),
+		evt.GetPlayerName(),
+		evt.GetShare().String(),
+		title,
+		strings.Join(diceText, " "),
+		strconv.Itoa(sr.CountHits(dice)),
+		strconv.FormatBool(sr.IsGlitched(dice, glitchy)),
+		strconv.FormatBool(sr.IsCriticalGlitch(dice, glitchy)),
+	})
+}
+
+func (w *csvWriter) end() error {
+	w.out.Flush()
+	return w.out.Error()
+}
+
+type markdownWriter struct {
+	out io.Writer
+}
+
+func (w *markdownWriter) begin(gameID string) error {
+	_, err := fmt.Fprintf(w.out, "# %v\n\n", gameID)
+	return err
+}
+
+func (w *markdownWriter) write(evt event.Event) error {
+	line := PrintEvent(evt)
+	if evt.GetShare() == event.SharePrivate {
+		line += " _(private)_"
+	}
+	if dice, glitchy, ok := event.FinalDice(evt); ok {
+		line += fmt.Sprintf(": %v hits", sr.CountHits(dice))
+		if sr.IsCriticalGlitch(dice, glitchy) {
+			line += ", **critical glitch**"
+		} else if sr.IsGlitched(dice, glitchy) {
+			line += ", **glitch**"
+		}
+	}
+	_, err := fmt.Fprintf(w.out, "- `%v` %v\n",
+		eventTime(evt).Format("2006-01-02 15:04"), line,
+	)
+	return err
+}
+
+func (w *markdownWriter) end() error {
+	return nil
+}
+
+// eventTitle gets the title of event types which have one.
+func eventTitle(evt event.Event) string {
+	switch evt.(type) {
+	case *event.Roll:
+		return evt.(*event.Roll).Title
+	case *event.EdgeRoll:
+		return evt.(*event.EdgeRoll).Title
+	case *event.Reroll:
+		return evt.(*event.Reroll).Title
+	case *event.InitiativeRoll:
+		return evt.(*event.InitiativeRoll).Title
+	default:
+		return ""
+	}
+}
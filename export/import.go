@@ -0,0 +1,166 @@
+package export
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sr/event"
+	"sr/game"
+	"sr/id"
+	"sr/player"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// PlayerMapping maps player IDs in an export to player IDs on this server.
+type PlayerMapping map[id.UID]id.UID
+
+// ImportResult summarizes the events added by an import.
+type ImportResult struct {
+	Imported   int     `json:"imported"`
+	Collisions []int64 `json:"collisions"`
+}
+
+// ErrUnmappedPlayer means an imported event's player is not in the mapping
+// and is not a player in the target game.
+var ErrUnmappedPlayer = errors.New("unmapped player")
+
+// maxLineSize is the longest event line accepted by an import.
+const maxLineSize = 1 << 20
+
+// ReadPlayerMapping parses a JSON object of `{ "oldID": "newID" }`.
+func ReadPlayerMapping(input io.Reader) (PlayerMapping, error) {
+	var mapping PlayerMapping
+	decoder := json.NewDecoder(input)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&mapping); err != nil {
+		return nil, fmt.Errorf("decoding player mapping: %w", err)
+	}
+	return mapping, nil
+}
+
+// Import reads a JSON Lines export and adds its events to the given game.
+//
+// Every event must parse through `event.Parse`. The player IDs of each event,
+// and of its reactions and comments, are replaced using mapping; players
+// mapped to, and players missing from mapping, must already be in the game.
+// Events whose IDs are already in the game's
+// history (or repeat within the export) are not imported and are reported as
+// collisions instead. Nothing is written unless the whole export is valid.
+func Import(gameID string, input io.Reader, mapping PlayerMapping, conn redis.Conn) (*ImportResult, error) {
+	gamePlayers, err := game.GetPlayersIn(gameID, conn)
+	if err != nil && !errors.Is(err, game.ErrNotFound) {
+		return nil, fmt.Errorf("getting players in %v: %w", gameID, err)
+	}
+	inGame := player.MapByID(gamePlayers)
+	for fromID, toID := range mapping {
+		if _, found := inGame[toID]; !found {
+			return nil, fmt.Errorf("mapping %v -> %v: %w", fromID, toID, game.ErrNotInGame)
+		}
+	}
+	mapPlayer := func(playerID id.UID) (id.UID, bool) {
+		if mappedID, found := mapping[playerID]; found {
+			return mappedID, true
+		}
+		_, found := inGame[playerID]
+		return playerID, found
+	}
+
+	result := ImportResult{Collisions: []int64{}}
+	var events []event.Event
+	seen := make(map[int64]bool)
+	scanner := bufio.NewScanner(input)
+	scanner.Buffer(make([]byte, 4096), maxLineSize)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := scanner.Bytes()
+		if len(text) == 0 {
+			continue
+		}
+		evt, err := event.Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %v: %w", line, err)
+		}
+		if evt.GetID() <= 0 || !event.IsShare(int(evt.GetShare())) {
+			return nil, fmt.Errorf("line %v: invalid event %v", line, evt.GetID())
+		}
+
+		playerID := evt.GetPlayerID()
+		mappedID, found := mapPlayer(playerID)
+		if !found {
+			return nil, fmt.Errorf("line %v: %w %v (%v)",
+				line, ErrUnmappedPlayer, playerID, evt.GetPlayerName(),
+			)
+		}
+		if mappedID != playerID {
+			playerIDValue := reflect.Indirect(reflect.ValueOf(evt)).FieldByName("PlayerID")
+			if !playerIDValue.CanSet() {
+				return nil, fmt.Errorf("line %v: cannot set %#v of %#v", line, playerIDValue, evt)
+			}
+			playerIDValue.Set(reflect.ValueOf(mappedID))
+		}
+		reactions := evt.GetReactions()
+		for emoji, reacted := range reactions {
+			// Players mapped to the same player only react once
+			mappedReacted := make([]id.UID, 0, len(reacted))
+			for _, playerID := range reacted {
+				mappedID, found := mapPlayer(playerID)
+				if !found {
+					return nil, fmt.Errorf("line %v: %w %v (reacted %v)",
+						line, ErrUnmappedPlayer, playerID, emoji,
+					)
+				}
+				if !containsPlayer(mappedReacted, mappedID) {
+					mappedReacted = append(mappedReacted, mappedID)
+				}
+			}
+			reactions[emoji] = mappedReacted
+		}
+		comments := evt.GetComments()
+		for i, comment := range comments {
+			if comments[i].PlayerID, found = mapPlayer(comment.PlayerID); !found {
+				return nil, fmt.Errorf("line %v: %w %v (%v, comment %v)",
+					line, ErrUnmappedPlayer, comment.PlayerID, comment.PlayerName, comment.ID,
+				)
+			}
+		}
+
+		if seen[evt.GetID()] {
+			result.Collisions = append(result.Collisions, evt.GetID())
+			continue
+		}
+		seen[evt.GetID()] = true
+		events = append(events, evt)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading line %v: %w", line+1, err)
+	}
+
+	for start := 0; start < len(events); start += bufferSize {
+		end := start + bufferSize
+		if end > len(events) {
+			end = len(events)
+		}
+		collisions, err := game.ImportEvents(gameID, events[start:end], conn)
+		if err != nil {
+			return &result, fmt.Errorf("importing events %v-%v: %w", start, end, err)
+		}
+		result.Collisions = append(result.Collisions, collisions...)
+		result.Imported += end - start - len(collisions)
+	}
+	return &result, nil
+}
+
+// containsPlayer determines if a player ID is in a list of IDs.
+func containsPlayer(playerIDs []id.UID, playerID id.UID) bool {
+	for _, found := range playerIDs {
+		if found == playerID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+package export
+
+import (
+	"fmt"
+	"sr/event"
+)
+
+// PrintEvent renders a one-line, human-readable description of an event.
+func PrintEvent(evt event.Event) string {
+	switch evt.(type) {
+	case *event.Roll:
+		roll := evt.(*event.Roll)
+		rerolled := ""
+		if len(roll.Reroll) != 0 {
+			rerolled = fmt.Sprintf(" (rerolls %v)", len(roll.Reroll))
+		}
+		if roll.Title != "" {
+			return fmt.Sprintf("%v rolls %v dice to %v%v",
+				roll.PlayerName, len(roll.Dice), roll.Title, rerolled,
+			)
+		}
+		return fmt.Sprintf("%v rolls %v dice%v",
+			roll.PlayerName, len(roll.Dice), rerolled)
+	case *event.EdgeRoll:
+		edgeRoll := evt.(*event.EdgeRoll)
+		if edgeRoll.Title != "" {
+			return fmt.Sprintf("%v edge rolls %v rounds to %v",
+				edgeRoll.PlayerName, len(edgeRoll.Rounds), edgeRoll.Title,
+			)
+		}
+		return fmt.Sprintf("%v edge rolls %v rounds",
+			edgeRoll.PlayerName, len(edgeRoll.Rounds))
+	case *event.Reroll:
+		reroll := evt.(*event.Reroll)
+		if reroll.Title != "" {
+			return fmt.Sprintf("%v rerolls %v dice to %v",
+				reroll.PlayerName, len(reroll.Rounds[1]), reroll.Title,
+			)
+		}
+		return fmt.Sprintf("%v rerolls %v dice",
+			reroll.PlayerName, len(reroll.Rounds[1]),
+		)
+	case *event.InitiativeRoll:
+		initRoll := evt.(*event.InitiativeRoll)
+		title := "initiative"
+		if initRoll.Title != "" {
+			title = initRoll.Title
+		}
+		return fmt.Sprintf("%v rolls %v + %vd6 for %v",
+			initRoll.PlayerName, initRoll.Base, initRoll.Dice, title,
+		)
+	case *event.Chat:
+		chat := evt.(*event.Chat)
+		return fmt.Sprintf("%v: %v", chat.PlayerName, chat.Text)
+	case *event.SceneStart:
+		start := evt.(*event.SceneStart)
+		return fmt.Sprintf("%v starts the scene %v",
+			start.PlayerName, start.Title,
+		)
+	case *event.SceneEnd:
+		end := evt.(*event.SceneEnd)
+		return fmt.Sprintf("%v ends the scene %v",
+			end.PlayerName, end.Title,
+		)
+	case *event.PlayerJoin:
+		join := evt.(*event.PlayerJoin)
+		return fmt.Sprintf("%v joined <game>.",
+			join.PlayerName,
+		)
+	default:
+		return fmt.Sprintf("Unknown %#v", evt)
+	}
+}
@@ -0,0 +1,197 @@
+package sr
+
+import (
+	"log"
+	"math"
+	"sr/config"
+	"sync"
+	"time"
+)
+
+/*
+   Fairness Monitoring
+
+   Every die produced by the roll goroutine is recorded in a sliding window of
+   the most recent `config.RollFairnessWindow` dice. Every
+   `config.RollFairnessInterval` dice, the window is checked with:
+
+   - A chi-square goodness of fit test, checking that each face comes up 1/6 of
+     the time.
+   - A Wald-Wolfowitz runs test over low (1-3) and high (4-6) dice, checking
+     that dice don't come in streaks or alternate more than chance allows.
+
+   Both tests give the probability that fair dice would produce a window at
+   least as extreme. If either is below 1 in `config.RollFairnessAlertOdds`,
+   an alert is logged. A fair RNG will still alert occasionally.
+*/
+
+// Fairness is the result of the latest fairness check of rolled dice.
+type Fairness struct {
+	// Window is the number of dice checked.
+	Window int `json:"window"`
+	// Faces counts each face (1 - 6) in the window.
+	Faces [rollMax]int `json:"faces"`
+	// Total counts each face (1 - 6) rolled since the server started.
+	Total [rollMax]int64 `json:"total"`
+	// ChiSquare is the chi-square statistic of the faces in the window.
+	ChiSquare float64 `json:"chiSquare"`
+	// ChiSquareP is the probability of fair dice having this chi-square or higher.
+	ChiSquareP float64 `json:"chiSquareP"`
+	// Runs is the number of runs of low or high dice in the window.
+	Runs int `json:"runs"`
+	// RunsZ is the number of standard deviations from the expected runs.
+	RunsZ float64 `json:"runsZ"`
+	// RunsP is the probability of fair dice having runs this far from expected.
+	RunsP float64 `json:"runsP"`
+	// Alert is set when either test is below the alert threshold.
+	Alert bool `json:"alert"`
+	// CheckedAt is when the window was last checked, or zero if it has not been.
+	CheckedAt time.Time `json:"checkedAt"`
+	// ReadErrors counts errors reading from the hardware RNG.
+	ReadErrors int64 `json:"readErrors"`
+}
+
+type fairnessMonitor struct {
+	sync.Mutex
+	window      []int // ring buffer of the latest dice
+	next        int   // index of the next die in window
+	filled      int   // number of dice in window
+	sinceCheck  int
+	faces       [rollMax]int
+	total       [rollMax]int64
+	readErrors  int64
+	latest      Fairness
+	alertLogged bool
+}
+
+var monitor fairnessMonitor
+
+// recordDie adds a rolled die (1 - 6) to the fairness window.
+func (m *fairnessMonitor) recordDie(die int) {
+	m.Lock()
+	defer m.Unlock()
+	if m.window == nil {
+		m.window = make([]int, config.RollFairnessWindow)
+	}
+	if m.filled == len(m.window) {
+		m.faces[m.window[m.next]-1]--
+	} else {
+		m.filled++
+	}
+	m.window[m.next] = die
+	m.next = (m.next + 1) % len(m.window)
+	m.faces[die-1]++
+	m.total[die-1]++
+
+	m.sinceCheck++
+	if m.sinceCheck >= config.RollFairnessInterval {
+		m.sinceCheck = 0
+		m.check()
+	}
+}
+
+// recordReadError counts a failed read from the hardware RNG.
+func (m *fairnessMonitor) recordReadError() {
+	m.Lock()
+	defer m.Unlock()
+	m.readErrors++
+}
+
+// check runs the fairness tests over the window. m must be locked.
+func (m *fairnessMonitor) check() {
+	result := Fairness{
+		Window:    m.filled,
+		Faces:     m.faces,
+		Total:     m.total,
+		CheckedAt: time.Now(),
+	}
+	result.ChiSquare, result.ChiSquareP = chiSquareTest(m.faces, m.filled)
+	result.Runs, result.RunsZ, result.RunsP = m.runsTest()
+
+	threshold := 1 / float64(config.RollFairnessAlertOdds)
+	result.Alert = result.ChiSquareP < threshold || result.RunsP < threshold
+	if result.Alert && !m.alertLogged {
+		log.Printf("RNG fairness alert! Last %v dice: faces %v, chi-square %.2f (p = %.6f), %v runs (z = %.2f, p = %.6f)",
+			result.Window, result.Faces, result.ChiSquare, result.ChiSquareP,
+			result.Runs, result.RunsZ, result.RunsP,
+		)
+	} else if !result.Alert && m.alertLogged {
+		log.Printf("RNG fairness back within threshold: chi-square p = %.6f, runs p = %.6f",
+			result.ChiSquareP, result.RunsP,
+		)
+	}
+	m.alertLogged = result.Alert
+	m.latest = result
+}
+
+// runsTest performs the Wald-Wolfowitz runs test on the window, oldest die
+// first. m must be locked.
+func (m *fairnessMonitor) runsTest() (runs int, z float64, p float64) {
+	start := 0
+	if m.filled == len(m.window) {
+		start = m.next
+	}
+	var low, high float64
+	previousHigh := false
+	for i := 0; i < m.filled; i++ {
+		isHigh := m.window[(start+i)%len(m.window)] > rollMax/2
+		if isHigh {
+			high++
+		} else {
+			low++
+		}
+		if i == 0 || isHigh != previousHigh {
+			runs++
+		}
+		previousHigh = isHigh
+	}
+	n := low + high
+	if low == 0 || high == 0 || n < 2 {
+		return runs, 0, 1
+	}
+	expected := 2*low*high/n + 1
+	variance := 2 * low * high * (2*low*high - n) / (n * n * (n - 1))
+	if variance <= 0 {
+		return runs, 0, 1
+	}
+	z = (float64(runs) - expected) / math.Sqrt(variance)
+	return runs, z, math.Erfc(math.Abs(z) / math.Sqrt2)
+}
+
+// chiSquareTest gives the chi-square statistic of face counts against a fair
+// die, and the probability of fair dice producing that statistic or higher.
+func chiSquareTest(faces [rollMax]int, count int) (float64, float64) {
+	if count == 0 {
+		return 0, 1
+	}
+	expected := float64(count) / rollMax
+	chiSquare := 0.0
+	for _, observed := range faces {
+		diff := float64(observed) - expected
+		chiSquare += diff * diff / expected
+	}
+	return chiSquare, chiSquareSurvival5(chiSquare)
+}
+
+// chiSquareSurvival5 is the upper tail probability of the chi-square
+// distribution with 5 degrees of freedom (six faces).
+func chiSquareSurvival5(x float64) float64 {
+	if x <= 0 {
+		return 1
+	}
+	// For odd degrees of freedom k, the tail is
+	// erfc(sqrt(x/2)) + sqrt(2/pi) e^(-x/2) sum_{j=1}^{(k-1)/2} x^(j-1/2) / (1 * 3 * ... * (2j-1))
+	root := math.Sqrt(x)
+	sum := root + x*root/3
+	return math.Erfc(root/math.Sqrt2) + math.Sqrt(2/math.Pi)*math.Exp(-x/2)*sum
+}
+
+// RollFairness gives the result of the latest fairness check of rolled dice.
+func RollFairness() Fairness {
+	monitor.Lock()
+	defer monitor.Unlock()
+	result := monitor.latest
+	result.Total = monitor.total
+	result.ReadErrors = monitor.readErrors
+	return result
+}
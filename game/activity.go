@@ -0,0 +1,190 @@
+package game
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gomodule/redigo/redis"
+	"sr/config"
+	"sr/id"
+	"sr/player"
+	"sr/update"
+)
+
+// ActivityTyping indicates a player is typing a message.
+const ActivityTyping = "typing"
+
+// ActivityRolling indicates a player is making a roll.
+const ActivityRolling = "rolling"
+
+// ValidActivity determines if an activity indicator is valid. The empty
+// string clears the indicator.
+func ValidActivity(activity string) bool {
+	return activity == "" || activity == ActivityTyping || activity == ActivityRolling
+}
+
+// activeKey is a sorted set of the players in a game, scored by when they were
+// last active.
+func activeKey(gameID string) string {
+	return "active:" + gameID
+}
+
+// awayKey is a set of the players idle in a game.
+func awayKey(gameID string) string {
+	return "away:" + gameID
+}
+
+// activityKey is what a player is doing in a game, which expires if they
+// don't keep doing it.
+func activityKey(gameID string, playerID id.UID) string {
+	return "activity:" + gameID + ":" + string(playerID)
+}
+
+// MarkActive records that a player did something in a game, publishing that
+// they're no longer away if they were.
+func MarkActive(gameID string, playerID id.UID, conn redis.Conn) error {
+	// MULTI: set last active, remove away
+	if err := conn.Send("MULTI"); err != nil {
+		return fmt.Errorf("redis error sending `MULTI`: %w", err)
+	}
+	if err := conn.Send("ZADD", activeKey(gameID), nowMillis(), playerID); err != nil {
+		return fmt.Errorf("redis error sending `ZADD` active: %w", err)
+	}
+	if err := conn.Send("SREM", awayKey(gameID), playerID); err != nil {
+		return fmt.Errorf("redis error sending `SREM` away: %w", err)
+	}
+	// EXEC: [#added, #removed]
+	results, err := redis.Ints(conn.Do("EXEC"))
+	if err != nil {
+		return fmt.Errorf("redis error sending `EXEC`: %w", err)
+	}
+	if len(results) != 2 {
+		return fmt.Errorf("redis invalid marking %v active in %v: got %v", playerID, gameID, results)
+	}
+	if results[1] != 1 {
+		return nil
+	}
+	return publishActivity(gameID, playerID, map[string]interface{}{"away": false}, conn)
+}
+
+// CheckIdle publishes that a player is away if they've not been active in a
+// game for config.AwaySecs. It's checked with each subscription heartbeat.
+func CheckIdle(gameID string, playerID id.UID, conn redis.Conn) error {
+	lastActive, err := redis.Int64(conn.Do("ZSCORE", activeKey(gameID), playerID))
+	if errors.Is(err, redis.ErrNil) {
+		lastActive = 0
+	} else if err != nil {
+		return fmt.Errorf("redis error getting last active of %v: %w", playerID, err)
+	}
+	if nowMillis()-lastActive < int64(config.AwaySecs)*1000 {
+		return nil
+	}
+	added, err := redis.Int(conn.Do("SADD", awayKey(gameID), playerID))
+	if err != nil {
+		return fmt.Errorf("redis error setting %v away: %w", playerID, err)
+	}
+	// Only the subscription which set the player away announces it
+	if added != 1 {
+		return nil
+	}
+	return publishActivity(gameID, playerID, map[string]interface{}{"away": true}, conn)
+}
+
+// SetActivity sets what a player is doing in a game, such as typing or
+// rolling, and marks them active. The activity is cleared after
+// config.ActivitySecs, so clients should set it again while it continues, and
+// consider it cleared after that long without an update.
+func SetActivity(gameID string, playerID id.UID, activity string, conn redis.Conn) error {
+	if activity == "" {
+		if _, err := conn.Do("DEL", activityKey(gameID, playerID)); err != nil {
+			return fmt.Errorf("redis error clearing activity of %v: %w", playerID, err)
+		}
+	} else if _, err := conn.Do(
+		"SET", activityKey(gameID, playerID), activity, "EX", config.ActivitySecs,
+	); err != nil {
+		return fmt.Errorf("redis error setting activity of %v: %w", playerID, err)
+	}
+	if err := MarkActive(gameID, playerID, conn); err != nil {
+		return err
+	}
+	return publishActivity(gameID, playerID, map[string]interface{}{"activity": activity}, conn)
+}
+
+// clearActivity removes a player's away status and activity once they've
+// disconnected from a game.
+func clearActivity(gameID string, playerID id.UID, conn redis.Conn) error {
+	// MULTI: remove away, remove activity
+	if err := conn.Send("MULTI"); err != nil {
+		return fmt.Errorf("redis error sending `MULTI`: %w", err)
+	}
+	if err := conn.Send("SREM", awayKey(gameID), playerID); err != nil {
+		return fmt.Errorf("redis error sending `SREM` away: %w", err)
+	}
+	if err := conn.Send("DEL", activityKey(gameID, playerID)); err != nil {
+		return fmt.Errorf("redis error sending `DEL` activity: %w", err)
+	}
+	if _, err := conn.Do("EXEC"); err != nil {
+		return fmt.Errorf("redis error sending `EXEC`: %w", err)
+	}
+	return nil
+}
+
+// publishActivity publishes a change in a player's activity to a game, unless
+// they've chosen to be shown as offline.
+func publishActivity(gameID string, playerID id.UID, diff map[string]interface{}, conn redis.Conn) error {
+	mode, err := getOnlineMode(playerID, conn)
+	if err != nil {
+		return err
+	}
+	if mode == player.OnlineModeOffline {
+		return nil
+	}
+	updateBytes, err := json.Marshal(update.ForPlayerDiff(playerID, diff))
+	if err != nil {
+		return fmt.Errorf("unable to marshal activity of %v to JSON: %w", playerID, err)
+	}
+	if _, err = conn.Do("PUBLISH", "update:"+gameID, updateBytes); err != nil {
+		return fmt.Errorf("redis error publishing activity of %v: %w", playerID, err)
+	}
+	return nil
+}
+
+// GetActivities retrieves which players in a game are away, and what the
+// players are doing.
+func GetActivities(gameID string, playerIDs []id.UID, conn redis.Conn) (map[id.UID]bool, map[id.UID]string, error) {
+	awayIDs, err := redis.Strings(conn.Do("SMEMBERS", awayKey(gameID)))
+	if err != nil {
+		return nil, nil, fmt.Errorf("redis error getting away players in %v: %w", gameID, err)
+	}
+	away := make(map[id.UID]bool, len(awayIDs))
+	for _, playerID := range awayIDs {
+		away[id.UID(playerID)] = true
+	}
+	activities := make(map[id.UID]string)
+	if len(playerIDs) == 0 {
+		return away, activities, nil
+	}
+	keys := make([]interface{}, len(playerIDs))
+	for i, playerID := range playerIDs {
+		keys[i] = activityKey(gameID, playerID)
+	}
+	values, err := redis.Strings(conn.Do("MGET", keys...))
+	if err != nil {
+		return nil, nil, fmt.Errorf("redis error getting activities in %v: %w", gameID, err)
+	}
+	for i, activity := range values {
+		if activity != "" {
+			activities[playerIDs[i]] = activity
+		}
+	}
+	return away, activities, nil
+}
+
+// IsAway determines if a player is idle in a game.
+func IsAway(gameID string, playerID id.UID, conn redis.Conn) (bool, error) {
+	away, err := redis.Bool(conn.Do("SISMEMBER", awayKey(gameID), playerID))
+	if err != nil {
+		return false, fmt.Errorf("redis error checking away of %v: %w", playerID, err)
+	}
+	return away, nil
+}
@@ -0,0 +1,86 @@
+package game
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gomodule/redigo/redis"
+	"sr/id"
+	"sr/update"
+)
+
+// RemovePlayer removes a player from a game and their game list, updates the
+// game's connected players, and closes the player's subscriptions to the game.
+// It returns ErrNotInGame if the player was not in the game.
+func RemovePlayer(gameID string, playerID id.UID, reason string, conn redis.Conn) error {
+	updateBytes, err := json.Marshal(update.ForPlayerRemove(playerID))
+	if err != nil {
+		return fmt.Errorf("marshal update to JSON: %w", err)
+	}
+
+	// MULTI: remove player, publish update, close subscriptions
+	if err = conn.Send("MULTI"); err != nil {
+		return fmt.Errorf("redis error sending `MULTI`: %w", err)
+	}
+	if err = conn.Send("HDEL", "players:"+gameID, playerID); err != nil {
+		return fmt.Errorf("redis error sending `HDEL` player: %w", err)
+	}
+	if err = conn.Send("SREM", "games:"+string(playerID), gameID); err != nil {
+		return fmt.Errorf("redis error sending `SREM` game: %w", err)
+	}
+	if err = conn.Send("PUBLISH", "update:"+gameID, updateBytes); err != nil {
+		return fmt.Errorf("redis error sending `PUBLISH` player: %w", err)
+	}
+	if err = conn.Send("PUBLISH", closeChannel(gameID, playerID), reason); err != nil {
+		return fmt.Errorf("redis error sending `PUBLISH` close: %w", err)
+	}
+	// EXEC: [#removed=1, #games, #updated, #closed]
+	results, err := redis.Ints(conn.Do("EXEC"))
+	if err != nil {
+		return fmt.Errorf("redis error sending `EXEC`: %w", err)
+	}
+	if len(results) != 4 {
+		return fmt.Errorf("redis invalid removing %v from %v: expected [1, *, *, *], got %v",
+			playerID, gameID, results,
+		)
+	}
+	if results[0] != 1 {
+		return fmt.Errorf("%w: %v in %v", ErrNotInGame, playerID, gameID)
+	}
+	return nil
+}
+
+// IsBanned determines if a player is banned from a game.
+func IsBanned(gameID string, playerID id.UID, conn redis.Conn) (bool, error) {
+	banned, err := redis.Bool(conn.Do("SISMEMBER", "banned:"+gameID, playerID))
+	if err != nil {
+		return false, fmt.Errorf("redis error checking ban of %v: %w", playerID, err)
+	}
+	return banned, nil
+}
+
+// GetBanned retrieves the IDs of the players banned from a game.
+func GetBanned(gameID string, conn redis.Conn) ([]string, error) {
+	banned, err := redis.Strings(conn.Do("SMEMBERS", "banned:"+gameID))
+	if err != nil {
+		return nil, fmt.Errorf("redis error getting banned players: %w", err)
+	}
+	return banned, nil
+}
+
+// SetBanned bans or unbans a player from a game. Banned players can't log in
+// to or join the game. It returns whether the player's ban changed.
+func SetBanned(gameID string, playerID id.UID, banned bool, conn redis.Conn) (bool, error) {
+	command := "SADD"
+	if !banned {
+		command = "SREM"
+	}
+	changed, err := redis.Int(conn.Do(command, "banned:"+gameID, playerID))
+	if err != nil {
+		return false, fmt.Errorf("redis error sending `%v` ban: %w", command, err)
+	}
+	return changed == 1, nil
+}
+
+func closeChannel(gameID string, playerID id.UID) string {
+	return "close:" + string(playerID) + ":" + gameID
+}
@@ -2,9 +2,13 @@ package game
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/gomodule/redigo/redis"
+	"log"
+	"sr/config"
 	"sr/event"
+	"sr/id"
 	"sr/player"
 	"sr/update"
 )
@@ -39,8 +43,21 @@ func UpdateChannel(gameID string, evt event.Event) string {
 	}
 }
 
-// PostEvent adds an event to redis, sending an update for non-private events
+// PostEvent adds an event to redis, sending an update for non-private events.
+// The event is tagged with the game's active scene, if there is one.
 func PostEvent(gameID string, evt event.Event, conn redis.Conn) error {
+	sceneID, err := GetActiveSceneID(gameID, conn)
+	if err != nil {
+		return fmt.Errorf("getting active scene: %w", err)
+	}
+	if sceneID != 0 {
+		evt.SetScene(sceneID)
+	}
+	return postEvent(gameID, evt, conn)
+}
+
+// postEvent adds an event to redis without changing its scene.
+func postEvent(gameID string, evt event.Event, conn redis.Conn) error {
 	channel := EventChannel(gameID, evt)
 	bytes, err := json.Marshal(evt)
 	if err != nil {
@@ -59,18 +76,189 @@ func PostEvent(gameID string, evt event.Event, conn redis.Conn) error {
 	if err != nil {
 		return fmt.Errorf("redis error sending publish event to history: %w", err)
 	}
+	statCount, err := sendStats(gameID, evt, 1, conn)
+	if err != nil {
+		return err
+	}
 	results, err := redis.Ints(conn.Do("EXEC"))
 	if err != nil {
 		return fmt.Errorf("redis error EXECing event post: %w", err)
 	}
-	if len(results) != 2 || results[0] != 1 {
+	if len(results) != 2+statCount || results[0] != 1 {
 		return fmt.Errorf("redis error posting event, expected [1, *], got %v", results)
 	}
 	return nil
 }
 
-// DeleteEvent removes an event from a game and updates the game's connected players.
+// ImportEvents adds events to a game's history, along with their stats,
+// without publishing them. Events whose IDs are already in the history are not
+// added, and their IDs are returned. The history is watched between checking
+// the IDs and adding the events, so events posted meanwhile are not replaced.
+func ImportEvents(gameID string, events []event.Event, conn redis.Conn) ([]int64, error) {
+	tryImport := func() ([]int64, error) {
+		if _, err := conn.Do("WATCH", "history:"+gameID); err != nil {
+			return nil, fmt.Errorf("redis error sending `WATCH`: %w", err)
+		}
+		for _, evt := range events {
+			if err := conn.Send("ZCOUNT", "history:"+gameID, evt.GetID(), evt.GetID()); err != nil {
+				return nil, fmt.Errorf("redis error sending `ZCOUNT` %v: %w", evt.GetID(), err)
+			}
+		}
+		if err := conn.Flush(); err != nil {
+			return nil, fmt.Errorf("redis error flushing `ZCOUNT`s: %w", err)
+		}
+		collisions := []int64{}
+		fresh := make([]event.Event, 0, len(events))
+		for _, evt := range events {
+			count, err := redis.Int(conn.Receive())
+			if err != nil {
+				return nil, fmt.Errorf("redis error counting event %v: %w", evt.GetID(), err)
+			}
+			if count != 0 {
+				collisions = append(collisions, evt.GetID())
+				continue
+			}
+			fresh = append(fresh, evt)
+		}
+
+		// MULTI: add events, add stats, or nil if aborted
+		if err := conn.Send("MULTI"); err != nil {
+			return nil, fmt.Errorf("redis error sending `MULTI`: %w", err)
+		}
+		for _, evt := range fresh {
+			bytes, err := json.Marshal(evt)
+			if err != nil {
+				return nil, fmt.Errorf("unable to marshal event %v to JSON: %w", evt.GetID(), err)
+			}
+			if err = conn.Send("ZADD", "history:"+gameID, "NX", evt.GetID(), bytes); err != nil {
+				return nil, fmt.Errorf("redis error sending `ZADD` %v: %w", evt.GetID(), err)
+			}
+			if _, err = sendStats(gameID, evt, 1, conn); err != nil {
+				return nil, err
+			}
+		}
+		_, err := redis.Ints(conn.Do("EXEC"))
+		if errors.Is(err, redis.ErrNil) {
+			return nil, ErrTransactionAborted
+		} else if err != nil {
+			return nil, fmt.Errorf("redis error sending `EXEC`: %w", err)
+		}
+		return collisions, nil
+	}
+	var err error
+	for i := 0; i < config.RedisRetries; i++ {
+		var collisions []int64
+		collisions, err = tryImport()
+		if !errors.Is(err, ErrTransactionAborted) {
+			return collisions, err
+		}
+	}
+	return nil, fmt.Errorf("after max attempts: %w", err)
+}
+
+// DeleteEvent moves an event from a game's history to its trash and updates
+// the game's connected players. It can be brought back with RestoreEvent until
+// the trash expires. Deleted events are unpinned.
 func DeleteEvent(gameID string, evt event.Event, conn redis.Conn) error {
+	if err := expireTrash(gameID, conn); err != nil {
+		return fmt.Errorf("expiring trash: %w", err)
+	}
+	channel := UpdateChannel(gameID, evt)
+	eventID := evt.GetID()
+	eventBytes, err := json.Marshal(evt)
+	if err != nil {
+		return fmt.Errorf("unable to marshal event to JSON: %w", err)
+	}
+	updateBytes, err := json.Marshal(update.ForEventDelete(eventID))
+	if err != nil {
+		return fmt.Errorf("redis error marshalling event delete update: %w", err)
+	}
+
+	tryDelete := func() error {
+		// Watch pins so the published pins match those left after the delete
+		if _, err := conn.Do("WATCH", "pins:"+gameID); err != nil {
+			return fmt.Errorf("redis error sending `WATCH`: %w", err)
+		}
+		pins, err := GetPins(gameID, conn)
+		if err != nil {
+			if _, unwatchErr := conn.Do("UNWATCH"); unwatchErr != nil {
+				return fmt.Errorf("redis error sending `UNWATCH`: %w", unwatchErr)
+			}
+			return err
+		}
+		remainingPins := make([]int64, 0, len(pins))
+		for _, pin := range pins {
+			if pin != eventID {
+				remainingPins = append(remainingPins, pin)
+			}
+		}
+		pinned := len(remainingPins) != len(pins)
+		pinsBytes, err := json.Marshal(update.ForGamePins(remainingPins))
+		if err != nil {
+			if _, unwatchErr := conn.Do("UNWATCH"); unwatchErr != nil {
+				return fmt.Errorf("redis error sending `UNWATCH`: %w", unwatchErr)
+			}
+			return fmt.Errorf("unable to marshal pins update to JSON: %w", err)
+		}
+
+		// MULTI: delete old event, add it to trash, unpin it, and publish updates
+		if err = conn.Send("MULTI"); err != nil {
+			return fmt.Errorf("redis error initializing event delete: %w", err)
+		}
+		if err = conn.Send("ZREMRANGEBYSCORE", "history:"+gameID, eventID, eventID); err != nil {
+			return fmt.Errorf("redis error sending event delete: %w", err)
+		}
+		if err = conn.Send("HSET", "trash:"+gameID, eventID, eventBytes); err != nil {
+			return fmt.Errorf("redis error sending event trash: %w", err)
+		}
+		if err = conn.Send("ZADD", "trashed:"+gameID, id.TimestampNow(), eventID); err != nil {
+			return fmt.Errorf("redis error sending event trash time: %w", err)
+		}
+		if err = conn.Send("ZREM", "pins:"+gameID, eventID); err != nil {
+			return fmt.Errorf("redis error sending event unpin: %w", err)
+		}
+		if err = conn.Send("PUBLISH", channel, updateBytes); err != nil {
+			return fmt.Errorf("redis error sending event publish: %w", err)
+		}
+		expected := 5
+		if pinned {
+			if err = conn.Send("PUBLISH", "update:"+gameID, pinsBytes); err != nil {
+				return fmt.Errorf("redis error sending pins publish: %w", err)
+			}
+			expected++
+		}
+		statCount, err := sendStats(gameID, evt, -1, conn)
+		if err != nil {
+			return err
+		}
+
+		// EXEC: [#deleted=1, #trashed, #trashed, #unpinned, #updated, #pins updated?, stats...],
+		// or nil if aborted
+		results, err := redis.Ints(conn.Do("EXEC"))
+		if errors.Is(err, redis.ErrNil) {
+			return ErrTransactionAborted
+		} else if err != nil {
+			return fmt.Errorf("redis error EXECing event delete: %w", err)
+		}
+		if len(results) != expected+statCount {
+			return fmt.Errorf("redis error deleting event, expected %v results got %v", expected+statCount, results)
+		}
+		if results[0] != 1 {
+			return fmt.Errorf("redis error deleting event, expected [1, *, *, *, *], got %v", results)
+		}
+		return nil
+	}
+	for i := 0; i < config.RedisRetries; i++ {
+		err = tryDelete()
+		if !errors.Is(err, ErrTransactionAborted) {
+			return err
+		}
+	}
+	return fmt.Errorf("after max attempts: %w", err)
+}
+
+// removeEvent removes an event from a game without moving it to the trash.
+func removeEvent(gameID string, evt event.Event, conn redis.Conn) error {
 	channel := UpdateChannel(gameID, evt)
 	eventID := evt.GetID()
 	updateBytes, err := json.Marshal(update.ForEventDelete(eventID))
@@ -91,13 +279,17 @@ func DeleteEvent(gameID string, evt event.Event, conn redis.Conn) error {
 	if err != nil {
 		return fmt.Errorf("redis error sending event publish: %w", err)
 	}
+	statCount, err := sendStats(gameID, evt, -1, conn)
+	if err != nil {
+		return err
+	}
 
-	// EXEC: [#deleted=1, #updated]
+	// EXEC: [#deleted=1, #updated, stats...]
 	results, err := redis.Ints(conn.Do("EXEC"))
 	if err != nil {
 		return fmt.Errorf("redis error EXECing event post: %w", err)
 	}
-	if len(results) != 2 {
+	if len(results) != 2+statCount {
 		return fmt.Errorf("redis error deleting event, expected 2 results got %v", results)
 	}
 	if results[0] != 1 {
@@ -106,7 +298,8 @@ func DeleteEvent(gameID string, evt event.Event, conn redis.Conn) error {
 	return nil
 }
 
-// UpdateEventShare changes the sharing of an event
+// UpdateEventShare changes the sharing of an event, unpinning it if it's no
+// longer shared with the game.
 func UpdateEventShare(gameID string, evt event.Event, newShare event.Share, conn redis.Conn) error {
 	if evt.GetShare() == newShare {
 		return fmt.Errorf("event %s matches share %s", evt, newShare.String())
@@ -119,13 +312,19 @@ func UpdateEventShare(gameID string, evt event.Event, newShare event.Share, conn
 
 	// Suffice to delete from group, then create in new group
 
-	if err := DeleteEvent(gameID, evt, conn); err != nil {
-		return fmt.Errorf("deleting event: %w", err)
+	if err := removeEvent(gameID, evt, conn); err != nil {
+		return fmt.Errorf("removing event: %w", err)
 	}
 	evt.SetShare(newShare)
-	if err := PostEvent(gameID, evt, conn); err != nil {
+	if err := postEvent(gameID, evt, conn); err != nil {
 		return fmt.Errorf("posting event: %w", err)
 	}
+	// Only events shared with the game can be pinned
+	if newShare != event.ShareInGame {
+		if _, err := SetPinned(gameID, evt.GetID(), false, conn); err != nil {
+			return fmt.Errorf("unpinning event: %w", err)
+		}
+	}
 	return nil
 
 	// game GMs => del game, (create GMs, create priv)
@@ -134,49 +333,124 @@ func UpdateEventShare(gameID string, evt event.Event, newShare event.Share, conn
 	// Gms priv => del Gms, _
 }
 
-// UpdateEvent replaces an event in the database and notifies players of the change.
-func UpdateEvent(gameID string, newEvent event.Event, update update.Event, conn redis.Conn) error {
-	channel := UpdateChannel(gameID, newEvent)
-	eventID := newEvent.GetID()
-	eventBytes, err := json.Marshal(newEvent)
-	if err != nil {
-		return fmt.Errorf("unable to marshal event to JSON: %w", err)
-	}
-	updateBytes, err := json.Marshal(update)
-	if err != nil {
-		return fmt.Errorf("unable to marshal update to JSON: %w", err)
-	}
+// ModifyEvent atomically changes an event in a game's history without saving
+// a revision, for changes players make to each other's events (i.e. reactions).
+// modify is given the event as it is stored and returns the diff to publish;
+// if the diff is empty no change is made. It may be called more than once if
+// the history changes during the transaction.
+func ModifyEvent(gameID string, eventID int64, modify func(evt event.Event) (map[string]interface{}, error), conn redis.Conn) error {
+	return changeEvent(gameID, eventID, modify, false, conn)
+}
 
-	// MULTI: delete old event, insert new event, publish update
-	err = conn.Send("MULTI")
-	if err != nil {
-		return fmt.Errorf("redis error initializing event delete: %w", err)
-	}
-	// From what I can tell, ZADD does not let you update an existing element
-	// with the given score atomically. Since this is MULTI anyway, we delete
-	// the old event and add the new one.
-	// Ideally, we'd use ZDEL like we do in DeleteEvent() but I don't want the
-	// old event as a parameter and this at least helps prevent event duplication.
-	err = conn.Send("ZREMRANGEBYSCORE", "history:"+gameID, eventID, eventID)
-	if err != nil {
-		return fmt.Errorf("redis error sending event delete: %w", err)
-	}
-	err = conn.Send("ZADD", "history:"+gameID, "NX", eventID, eventBytes)
-	if err != nil {
-		return fmt.Errorf("redis error sending event delete: %w", err)
-	}
-	err = conn.Send("PUBLISH", channel, updateBytes)
-	if err != nil {
-		return fmt.Errorf("redis error sending event publish: %w", err)
-	}
+// ReviseEvent atomically changes an event in a game's history like
+// ModifyEvent, for edits its player makes. The previous version of the event is
+// saved to its revision list, and the update sent to players carries the diff
+// and the event's new revision count.
+func ReviseEvent(gameID string, eventID int64, revise func(evt event.Event) (map[string]interface{}, error), conn redis.Conn) error {
+	return changeEvent(gameID, eventID, revise, true, conn)
+}
 
-	// EXEC: [#deleted=1, #added=1, #players]
-	results, err := redis.Ints(conn.Do("EXEC"))
-	if err != nil {
-		return fmt.Errorf("redis error EXECing event post: %w", err)
+// changeEvent changes an event while watching the game's history, retrying if
+// the history changed, and saves its previous version if revise is set.
+func changeEvent(gameID string, eventID int64, modify func(evt event.Event) (map[string]interface{}, error), revise bool, conn redis.Conn) error {
+	tryModify := func() error {
+		if _, err := conn.Do("WATCH", "history:"+gameID); err != nil {
+			return fmt.Errorf("redis error sending `WATCH`: %w", err)
+		}
+		unwatch := func() {
+			if _, err := conn.Do("UNWATCH"); err != nil {
+				log.Printf("redis error sending `UNWATCH`: %v", err)
+			}
+		}
+		eventText, err := event.GetByID(gameID, eventID, conn)
+		if err != nil {
+			unwatch()
+			return fmt.Errorf("getting event: %w", err)
+		}
+		previous, err := event.Parse([]byte(eventText))
+		if err != nil {
+			unwatch()
+			return fmt.Errorf("parsing event: %w", err)
+		}
+		evt, err := event.Parse([]byte(eventText))
+		if err != nil {
+			unwatch()
+			return fmt.Errorf("parsing event: %w", err)
+		}
+		diff, err := modify(evt)
+		if err != nil {
+			unwatch()
+			return err
+		}
+		if len(diff) == 0 {
+			unwatch()
+			return nil
+		}
+		var eventUpdate update.Event
+		if revise {
+			evt.SetRevs(evt.GetRevs() + 1)
+			eventUpdate = update.ForEventRevision(evt, diff)
+		} else {
+			eventUpdate = update.ForEventDiff(evt, diff)
+		}
+		eventBytes, err := json.Marshal(evt)
+		if err != nil {
+			unwatch()
+			return fmt.Errorf("unable to marshal event to JSON: %w", err)
+		}
+		updateBytes, err := json.Marshal(eventUpdate)
+		if err != nil {
+			unwatch()
+			return fmt.Errorf("unable to marshal update to JSON: %w", err)
+		}
+
+		// MULTI: save old event, delete old event, insert new event, publish update
+		if err = conn.Send("MULTI"); err != nil {
+			return fmt.Errorf("redis error initializing event modify: %w", err)
+		}
+		expected := 3
+		if revise {
+			if err = conn.Send("RPUSH", event.RevisionsKey(gameID, eventID), eventText); err != nil {
+				return fmt.Errorf("redis error sending event revision: %w", err)
+			}
+			expected++
+		}
+		// ZADD can't replace the member with a score, so the old event is removed.
+		if err = conn.Send("ZREMRANGEBYSCORE", "history:"+gameID, eventID, eventID); err != nil {
+			return fmt.Errorf("redis error sending event delete: %w", err)
+		}
+		if err = conn.Send("ZADD", "history:"+gameID, "NX", eventID, eventBytes); err != nil {
+			return fmt.Errorf("redis error sending event add: %w", err)
+		}
+		if err = conn.Send("PUBLISH", UpdateChannel(gameID, evt), updateBytes); err != nil {
+			return fmt.Errorf("redis error sending event publish: %w", err)
+		}
+		statCount, err := sendStatsChange(gameID, previous, evt, conn)
+		if err != nil {
+			return err
+		}
+
+		// EXEC: [#revisions?, #deleted=1, #added=1, #players, stats...], or nil if aborted
+		results, err := redis.Ints(conn.Do("EXEC"))
+		if errors.Is(err, redis.ErrNil) {
+			return ErrTransactionAborted
+		} else if err != nil {
+			return fmt.Errorf("redis error EXECing event modify: %w", err)
+		}
+		if len(results) != expected+statCount {
+			return fmt.Errorf("redis error modifying event, expected %v results, got %v", expected+statCount, results)
+		}
+		if changed := results[expected-3:]; changed[0] != 1 || changed[1] != 1 {
+			return fmt.Errorf("redis error modifying event, expected [*?, 1, 1, *], got %v", results)
+		}
+		return nil
 	}
-	if len(results) != 3 || results[0] != 1 || results[1] != 1 {
-		return fmt.Errorf("redis error updating event, expected [1, 1, *], got %v", results)
+	var err error
+	for i := 0; i < config.RedisRetries; i++ {
+		err = tryModify()
+		if !errors.Is(err, ErrTransactionAborted) {
+			return err
+		}
 	}
-	return nil
+	return fmt.Errorf("after max attempts: %w", err)
 }
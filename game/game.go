@@ -12,6 +12,9 @@ import (
 // ErrNotFound means that a specified game does not exists
 var ErrNotFound = errors.New("game not found")
 
+// ErrExists means that a game was created with the ID of an existing game
+var ErrExists = errors.New("game already exists")
+
 // ErrTransactionAborted means that a transaction was aborted and should be retried
 var ErrTransactionAborted = errors.New("transaction aborted")
 
@@ -20,6 +23,27 @@ func Exists(gameID string, conn redis.Conn) (bool, error) {
 	return redis.Bool(conn.Do("exists", "game:"+gameID))
 }
 
+// Create creates a new game with the given player as its owner, and adds
+// them to the game.
+func Create(gameID string, owner *player.Player, conn redis.Conn) error {
+	created, err := redis.Int(conn.Do(
+		"HSETNX", "game:"+gameID, "created_at", id.TimestampNow(),
+	))
+	if err != nil {
+		return fmt.Errorf("redis error creating game %v: %w", gameID, err)
+	}
+	if created != 1 {
+		return fmt.Errorf("%w: %v", ErrExists, gameID)
+	}
+	if _, err = conn.Do("HSET", "game:"+gameID, "owner", owner.ID); err != nil {
+		return fmt.Errorf("redis error setting owner of %v: %w", gameID, err)
+	}
+	if err = AddPlayer(gameID, owner, RoleOwner, conn); err != nil {
+		return fmt.Errorf("adding owner to %v: %w", gameID, err)
+	}
+	return nil
+}
+
 // GetPlayersIn retrieves the list of players in a game.
 // Returns ErrNotFound if the game is not found OR if it has no players.
 func GetPlayersIn(gameID string, conn redis.Conn) ([]player.Player, error) {
@@ -27,7 +51,7 @@ func GetPlayersIn(gameID string, conn redis.Conn) ([]player.Player, error) {
 		if _, err := conn.Do("WATCH", "players:"+gameID); err != nil {
 			return nil, nil, fmt.Errorf("redis error sending `WATCH`: %w", err)
 		}
-		playerIDs, err := redis.Strings(conn.Do("SMEMBERS", "players:"+gameID))
+		playerIDs, err := redis.Strings(conn.Do("HKEYS", "players:"+gameID))
 		if err != nil {
 			return nil, nil, fmt.Errorf("redis error retrieving player ID list: %w", err)
 		}
@@ -103,8 +127,13 @@ func GetPlayersIn(gameID string, conn redis.Conn) ([]player.Player, error) {
 // Info represents basic info about a game that the frontend would want
 // by default, all at once.
 type Info struct {
-	ID      string                 `json:"id"`
-	Players map[string]player.Info `json:"players"`
+	ID           string                 `json:"id"`
+	Players      map[string]player.Info `json:"players"`
+	Roles        map[string]Role        `json:"roles"`
+	Pins         []int64                `json:"pins"`
+	Scene        *Scene                 `json:"scene,omitempty"`
+	Spectators   bool                   `json:"spectators"`
+	JoinRequests bool                   `json:"joinRequests"`
 }
 
 // GetInfo retrieves `Info` for the given ID
@@ -113,9 +142,54 @@ func GetInfo(gameID string, conn redis.Conn) (*Info, error) {
 	if err != nil {
 		return nil, fmt.Errorf("error getting players in game %v: %w", gameID, err)
 	}
+	connected, err := GetConnected(gameID, conn)
+	if err != nil {
+		return nil, fmt.Errorf("error getting connected players in game %v: %w", gameID, err)
+	}
+	playerIDs := make([]id.UID, len(players))
+	for i, player := range players {
+		playerIDs[i] = player.ID
+	}
+	away, activities, err := GetActivities(gameID, playerIDs, conn)
+	if err != nil {
+		return nil, fmt.Errorf("error getting activities in game %v: %w", gameID, err)
+	}
 	info := make(map[string]player.Info, len(players))
 	for _, player := range players {
+		player.Connected = connected[player.ID]
+		player.Idle = away[player.ID]
+		player.Activity = activities[player.ID]
 		info[string(player.ID)] = player.Info()
 	}
-	return &Info{ID: gameID, Players: info}, nil
+	pins, err := GetPins(gameID, conn)
+	if err != nil {
+		return nil, fmt.Errorf("error getting pins in game %v: %w", gameID, err)
+	}
+	roles, err := GetRoles(gameID, conn)
+	if err != nil {
+		return nil, fmt.Errorf("error getting roles in game %v: %w", gameID, err)
+	}
+	spectators, err := AllowsSpectators(gameID, conn)
+	if err != nil {
+		return nil, fmt.Errorf("error getting spectators in game %v: %w", gameID, err)
+	}
+	requests, err := AllowsJoinRequests(gameID, conn)
+	if err != nil {
+		return nil, fmt.Errorf("error getting join requests in game %v: %w", gameID, err)
+	}
+	gameInfo := Info{
+		ID: gameID, Players: info, Roles: roles, Pins: pins,
+		Spectators: spectators, JoinRequests: requests,
+	}
+	sceneID, err := GetActiveSceneID(gameID, conn)
+	if err != nil {
+		return nil, fmt.Errorf("error getting scene in game %v: %w", gameID, err)
+	}
+	if sceneID != 0 {
+		gameInfo.Scene, err = GetScene(gameID, sceneID, conn)
+		if err != nil {
+			return nil, fmt.Errorf("error getting scene in game %v: %w", gameID, err)
+		}
+	}
+	return &gameInfo, nil
 }
@@ -0,0 +1,214 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gomodule/redigo/redis"
+	"sr/config"
+	"sr/id"
+	"time"
+)
+
+// ErrInviteNotFound means an invite code does not exist or has expired.
+var ErrInviteNotFound = errors.New("invite not found")
+
+// ErrInviteUsedUp means an invite code has no uses left.
+var ErrInviteUsedUp = errors.New("invite used up")
+
+// Invite is a code which lets new players join a game, a limited number of
+// times until it expires.
+type Invite struct {
+	Code      string `json:"code" redis:"-"`
+	GameID    string `json:"gameID" redis:"gameID"`
+	Role      Role   `json:"role" redis:"role"`
+	Uses      int    `json:"uses" redis:"uses"`
+	Expires   int64  `json:"expires" redis:"expires"`
+	CreatedBy id.UID `json:"createdBy" redis:"createdBy"`
+}
+
+func inviteKey(code string) string {
+	return "invite:" + code
+}
+
+// CreateInvite mints an invite code for a game. Players who join with it get
+// the given role. It can be used uses times before it expires.
+func CreateInvite(gameID string, creatorID id.UID, role Role, uses int, expiry time.Duration, conn redis.Conn) (*Invite, error) {
+	invite := Invite{
+		Code:      id.GenInviteCode(),
+		GameID:    gameID,
+		Role:      role,
+		Uses:      uses,
+		Expires:   id.TimestampNow() + expiry.Milliseconds(),
+		CreatedBy: creatorID,
+	}
+
+	// MULTI: set invite info, expire invite, add to game's invites
+	if err := conn.Send("MULTI"); err != nil {
+		return nil, fmt.Errorf("redis error sending `MULTI`: %w", err)
+	}
+	if err := conn.Send("HSET", redis.Args{}.Add(inviteKey(invite.Code)).AddFlat(&invite)...); err != nil {
+		return nil, fmt.Errorf("redis error sending `HSET` invite: %w", err)
+	}
+	if err := conn.Send("PEXPIREAT", inviteKey(invite.Code), invite.Expires); err != nil {
+		return nil, fmt.Errorf("redis error sending `PEXPIREAT` invite: %w", err)
+	}
+	if err := conn.Send("ZADD", "invites:"+gameID, invite.Expires, invite.Code); err != nil {
+		return nil, fmt.Errorf("redis error sending `ZADD` invite: %w", err)
+	}
+	if _, err := conn.Do("EXEC"); err != nil {
+		return nil, fmt.Errorf("redis error sending `EXEC`: %w", err)
+	}
+	return &invite, nil
+}
+
+// GetInvite retrieves an invite by its code.
+func GetInvite(code string, conn redis.Conn) (*Invite, error) {
+	data, err := redis.Values(conn.Do("HGETALL", inviteKey(code)))
+	if err != nil {
+		return nil, fmt.Errorf("redis error getting invite: %w", err)
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("%w: %v", ErrInviteNotFound, code)
+	}
+	invite := Invite{Code: code}
+	if err = redis.ScanStruct(data, &invite); err != nil {
+		return nil, fmt.Errorf("redis error parsing invite: %w", err)
+	}
+	return &invite, nil
+}
+
+// GetInvites retrieves the unexpired invites of a game, soonest to expire first.
+func GetInvites(gameID string, conn redis.Conn) ([]Invite, error) {
+	now := id.TimestampNow()
+	if _, err := conn.Do("ZREMRANGEBYSCORE", "invites:"+gameID, "-inf", now); err != nil {
+		return nil, fmt.Errorf("redis error removing expired invites: %w", err)
+	}
+	codes, err := redis.Strings(conn.Do("ZRANGE", "invites:"+gameID, 0, -1))
+	if err != nil {
+		return nil, fmt.Errorf("redis error getting invites: %w", err)
+	}
+	invites := make([]Invite, 0, len(codes))
+	for _, code := range codes {
+		invite, err := GetInvite(code, conn)
+		if errors.Is(err, ErrInviteNotFound) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		invites = append(invites, *invite)
+	}
+	return invites, nil
+}
+
+// RevokeInvite deletes an invite of a game.
+func RevokeInvite(gameID string, code string, conn redis.Conn) error {
+	invite, err := GetInvite(code, conn)
+	if err != nil {
+		return err
+	}
+	if invite.GameID != gameID {
+		return fmt.Errorf("%w: %v in %v", ErrInviteNotFound, code, gameID)
+	}
+
+	// MULTI: delete invite, remove from game's invites
+	if err = conn.Send("MULTI"); err != nil {
+		return fmt.Errorf("redis error sending `MULTI`: %w", err)
+	}
+	if err = conn.Send("DEL", inviteKey(code)); err != nil {
+		return fmt.Errorf("redis error sending `DEL` invite: %w", err)
+	}
+	if err = conn.Send("ZREM", "invites:"+gameID, code); err != nil {
+		return fmt.Errorf("redis error sending `ZREM` invite: %w", err)
+	}
+	if _, err = conn.Do("EXEC"); err != nil {
+		return fmt.Errorf("redis error sending `EXEC`: %w", err)
+	}
+	return nil
+}
+
+// RedeemInvite uses up one use of an invite, returning the invite.
+func RedeemInvite(code string, conn redis.Conn) (*Invite, error) {
+	tryRedeem := func() (*Invite, error) {
+		if _, err := conn.Do("WATCH", inviteKey(code)); err != nil {
+			return nil, fmt.Errorf("redis error sending `WATCH`: %w", err)
+		}
+		invite, err := GetInvite(code, conn)
+		if err == nil && invite.Uses <= 0 {
+			err = fmt.Errorf("%w: %v", ErrInviteUsedUp, code)
+		}
+		if err != nil {
+			if _, unwatchErr := conn.Do("UNWATCH"); unwatchErr != nil {
+				return nil, fmt.Errorf("redis error sending `UNWATCH`: %w", unwatchErr)
+			}
+			return nil, err
+		}
+
+		// MULTI: decrement uses, or nil if aborted
+		if err = conn.Send("MULTI"); err != nil {
+			return nil, fmt.Errorf("redis error sending `MULTI`: %w", err)
+		}
+		if err = conn.Send("HINCRBY", inviteKey(code), "uses", -1); err != nil {
+			return nil, fmt.Errorf("redis error sending `HINCRBY` uses: %w", err)
+		}
+		_, err = redis.Ints(conn.Do("EXEC"))
+		if errors.Is(err, redis.ErrNil) {
+			return nil, ErrTransactionAborted
+		} else if err != nil {
+			return nil, fmt.Errorf("redis error sending `EXEC`: %w", err)
+		}
+		invite.Uses--
+		return invite, nil
+	}
+	var err error
+	for i := 0; i < config.RedisRetries; i++ {
+		var invite *Invite
+		invite, err = tryRedeem()
+		if !errors.Is(err, ErrTransactionAborted) {
+			return invite, err
+		}
+	}
+	return nil, fmt.Errorf("after max attempts: %w", err)
+}
+
+// ReturnInvite gives back a use of an invite which was redeemed by a join that
+// then failed. Invites which have since expired or been revoked are unchanged.
+func ReturnInvite(code string, conn redis.Conn) error {
+	tryReturn := func() error {
+		if _, err := conn.Do("WATCH", inviteKey(code)); err != nil {
+			return fmt.Errorf("redis error sending `WATCH`: %w", err)
+		}
+		exists, err := redis.Bool(conn.Do("EXISTS", inviteKey(code)))
+		if err != nil || !exists {
+			if _, unwatchErr := conn.Do("UNWATCH"); unwatchErr != nil {
+				return fmt.Errorf("redis error sending `UNWATCH`: %w", unwatchErr)
+			}
+			if err != nil {
+				return fmt.Errorf("redis error checking invite %v: %w", code, err)
+			}
+			return nil
+		}
+
+		// MULTI: increment uses, or nil if aborted
+		if err = conn.Send("MULTI"); err != nil {
+			return fmt.Errorf("redis error sending `MULTI`: %w", err)
+		}
+		if err = conn.Send("HINCRBY", inviteKey(code), "uses", 1); err != nil {
+			return fmt.Errorf("redis error sending `HINCRBY` uses: %w", err)
+		}
+		_, err = redis.Ints(conn.Do("EXEC"))
+		if errors.Is(err, redis.ErrNil) {
+			return ErrTransactionAborted
+		} else if err != nil {
+			return fmt.Errorf("redis error sending `EXEC`: %w", err)
+		}
+		return nil
+	}
+	var err error
+	for i := 0; i < config.RedisRetries; i++ {
+		err = tryReturn()
+		if !errors.Is(err, ErrTransactionAborted) {
+			return err
+		}
+	}
+	return fmt.Errorf("after max attempts: %w", err)
+}
@@ -0,0 +1,317 @@
+package game
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gomodule/redigo/redis"
+	"sr/config"
+	"sr/id"
+	"sr/update"
+	"time"
+)
+
+// JoinStatusPending is the status of a join request no GM has answered.
+const JoinStatusPending = "pending"
+
+// JoinStatusApproved is the status of a join request a GM approved.
+const JoinStatusApproved = "approved"
+
+// JoinStatusDenied is the status of a join request a GM denied.
+const JoinStatusDenied = "denied"
+
+// ErrJoinRequestNotFound means a join request does not exist or has expired.
+var ErrJoinRequestNotFound = errors.New("join request not found")
+
+// ErrJoinRequestAnswered means a join request has already been approved or
+// denied.
+var ErrJoinRequestAnswered = errors.New("join request already answered")
+
+// ErrTooManyJoinRequests means a game has too many pending join requests to
+// accept another.
+var ErrTooManyJoinRequests = errors.New("too many join requests")
+
+// JoinRequest is a request from a player to join a game, which a GM approves
+// or denies. The requester checks on it with its token.
+type JoinRequest struct {
+	ID       string `json:"id" redis:"-"`
+	GameID   string `json:"-" redis:"gameID"`
+	Token    string `json:"-" redis:"token"`
+	Username string `json:"username" redis:"username"`
+	Name     string `json:"name" redis:"name"`
+	Status   string `json:"status" redis:"status"`
+	Created  int64  `json:"created" redis:"created"`
+	PlayerID id.UID `json:"-" redis:"playerID"`
+}
+
+func joinRequestKey(requestID string) string {
+	return "join-request:" + requestID
+}
+
+// AllowsJoinRequests determines if players can request to join a game.
+func AllowsJoinRequests(gameID string, conn redis.Conn) (bool, error) {
+	allowed, err := redis.Bool(conn.Do("HGET", "game:"+gameID, "joinRequests"))
+	if errors.Is(err, redis.ErrNil) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("redis error getting joinRequests: %w", err)
+	}
+	return allowed, nil
+}
+
+// SetAllowsJoinRequests allows or disallows players from requesting to join a
+// game, and updates the game's connected players. Pending requests can still
+// be answered.
+func SetAllowsJoinRequests(gameID string, allowed bool, conn redis.Conn) error {
+	updateBytes, err := json.Marshal(update.ForGameDiff(
+		map[string]interface{}{"joinRequests": allowed},
+	))
+	if err != nil {
+		return fmt.Errorf("marshal update to JSON: %w", err)
+	}
+
+	// MULTI: set joinRequests, publish update
+	if err = conn.Send("MULTI"); err != nil {
+		return fmt.Errorf("redis error sending `MULTI`: %w", err)
+	}
+	if err = conn.Send("HSET", "game:"+gameID, "joinRequests", allowed); err != nil {
+		return fmt.Errorf("redis error sending `HSET` joinRequests: %w", err)
+	}
+	if err = conn.Send("PUBLISH", "update:"+gameID, updateBytes); err != nil {
+		return fmt.Errorf("redis error sending `PUBLISH` joinRequests: %w", err)
+	}
+	if _, err = conn.Do("EXEC"); err != nil {
+		return fmt.Errorf("redis error sending `EXEC`: %w", err)
+	}
+	return nil
+}
+
+// CreateJoinRequest adds a pending request to join a game, and sends the
+// game's pending requests to players who can answer it. The playerID is of the
+// existing player asking to join, or empty for a new player.
+func CreateJoinRequest(gameID string, username string, name string, playerID id.UID, conn redis.Conn) (*JoinRequest, error) {
+	pending, err := redis.Int(conn.Do("ZCARD", "join-requests:"+gameID))
+	if err != nil {
+		return nil, fmt.Errorf("redis error counting join requests: %w", err)
+	}
+	if pending >= config.MaxJoinRequests {
+		return nil, fmt.Errorf("%w: %v in %v", ErrTooManyJoinRequests, pending, gameID)
+	}
+	request := JoinRequest{
+		ID:       string(id.GenUID()),
+		GameID:   gameID,
+		Token:    string(id.GenSessionID()),
+		Username: username,
+		Name:     name,
+		Status:   JoinStatusPending,
+		Created:  id.TimestampNow(),
+		PlayerID: playerID,
+	}
+	expiry := time.Duration(config.JoinRequestHours) * time.Hour
+
+	// MULTI: set request info, expire request, add to game's requests
+	if err = conn.Send("MULTI"); err != nil {
+		return nil, fmt.Errorf("redis error sending `MULTI`: %w", err)
+	}
+	if err = conn.Send("HSET", redis.Args{}.Add(joinRequestKey(request.ID)).AddFlat(&request)...); err != nil {
+		return nil, fmt.Errorf("redis error sending `HSET` join request: %w", err)
+	}
+	if err = conn.Send("EXPIRE", joinRequestKey(request.ID), int(expiry.Seconds())); err != nil {
+		return nil, fmt.Errorf("redis error sending `EXPIRE` join request: %w", err)
+	}
+	if err = conn.Send("ZADD", "join-requests:"+gameID, request.Created, request.ID); err != nil {
+		return nil, fmt.Errorf("redis error sending `ZADD` join request: %w", err)
+	}
+	if _, err = conn.Do("EXEC"); err != nil {
+		return nil, fmt.Errorf("redis error sending `EXEC`: %w", err)
+	}
+	if err = publishJoinRequests(gameID, conn); err != nil {
+		return nil, err
+	}
+	return &request, nil
+}
+
+// GetJoinRequest retrieves a join request by its ID.
+func GetJoinRequest(requestID string, conn redis.Conn) (*JoinRequest, error) {
+	data, err := redis.Values(conn.Do("HGETALL", joinRequestKey(requestID)))
+	if err != nil {
+		return nil, fmt.Errorf("redis error getting join request: %w", err)
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("%w: %v", ErrJoinRequestNotFound, requestID)
+	}
+	request := JoinRequest{ID: requestID}
+	if err = redis.ScanStruct(data, &request); err != nil {
+		return nil, fmt.Errorf("redis error parsing join request: %w", err)
+	}
+	return &request, nil
+}
+
+// GetJoinRequests retrieves the pending join requests of a game, oldest first.
+func GetJoinRequests(gameID string, conn redis.Conn) ([]JoinRequest, error) {
+	requestIDs, err := redis.Strings(conn.Do("ZRANGE", "join-requests:"+gameID, 0, -1))
+	if err != nil {
+		return nil, fmt.Errorf("redis error getting join requests: %w", err)
+	}
+	requests := make([]JoinRequest, 0, len(requestIDs))
+	for _, requestID := range requestIDs {
+		request, err := GetJoinRequest(requestID, conn)
+		if errors.Is(err, ErrJoinRequestNotFound) {
+			// Expired; forget it
+			if _, err = conn.Do("ZREM", "join-requests:"+gameID, requestID); err != nil {
+				return nil, fmt.Errorf("redis error removing join request: %w", err)
+			}
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		requests = append(requests, *request)
+	}
+	return requests, nil
+}
+
+// AnswerJoinRequest approves or denies a pending join request of a game, and
+// sends the game's pending requests to players who can answer them. Approved
+// requests record the ID of the player who joined, which is created for
+// requests from new players.
+func AnswerJoinRequest(gameID string, requestID string, status string, playerID id.UID, conn redis.Conn) error {
+	tryAnswer := func() error {
+		if _, err := conn.Do("WATCH", joinRequestKey(requestID)); err != nil {
+			return fmt.Errorf("redis error sending `WATCH`: %w", err)
+		}
+		request, err := GetJoinRequest(requestID, conn)
+		if err == nil && request.GameID != gameID {
+			err = fmt.Errorf("%w: %v in %v", ErrJoinRequestNotFound, requestID, gameID)
+		} else if err == nil && request.Status != JoinStatusPending {
+			err = fmt.Errorf("%w: %v is %v", ErrJoinRequestAnswered, requestID, request.Status)
+		}
+		if err != nil {
+			if _, unwatchErr := conn.Do("UNWATCH"); unwatchErr != nil {
+				return fmt.Errorf("redis error sending `UNWATCH`: %w", unwatchErr)
+			}
+			return err
+		}
+
+		// MULTI: set status, remove from pending, or nil if aborted
+		if err = conn.Send("MULTI"); err != nil {
+			return fmt.Errorf("redis error sending `MULTI`: %w", err)
+		}
+		if err = conn.Send("HSET", joinRequestKey(requestID), "status", status, "playerID", playerID); err != nil {
+			return fmt.Errorf("redis error sending `HSET` join request: %w", err)
+		}
+		if err = conn.Send("ZREM", "join-requests:"+gameID, requestID); err != nil {
+			return fmt.Errorf("redis error sending `ZREM` join request: %w", err)
+		}
+		_, err = redis.Ints(conn.Do("EXEC"))
+		if errors.Is(err, redis.ErrNil) {
+			return ErrTransactionAborted
+		} else if err != nil {
+			return fmt.Errorf("redis error sending `EXEC`: %w", err)
+		}
+		return nil
+	}
+	var err error
+	for i := 0; i < config.RedisRetries; i++ {
+		err = tryAnswer()
+		if !errors.Is(err, ErrTransactionAborted) {
+			break
+		}
+	}
+	if errors.Is(err, ErrTransactionAborted) {
+		return fmt.Errorf("after max attempts: %w", err)
+	} else if err != nil {
+		return err
+	}
+	return publishJoinRequests(gameID, conn)
+}
+
+// ReopenJoinRequest puts an approved join request back to pending with its
+// original player, for when adding its player to the game failed. Requests
+// which have since expired are unchanged.
+func ReopenJoinRequest(request *JoinRequest, conn redis.Conn) error {
+	tryReopen := func() error {
+		if _, err := conn.Do("WATCH", joinRequestKey(request.ID)); err != nil {
+			return fmt.Errorf("redis error sending `WATCH`: %w", err)
+		}
+		exists, err := redis.Bool(conn.Do("EXISTS", joinRequestKey(request.ID)))
+		if err != nil || !exists {
+			if _, unwatchErr := conn.Do("UNWATCH"); unwatchErr != nil {
+				return fmt.Errorf("redis error sending `UNWATCH`: %w", unwatchErr)
+			}
+			if err != nil {
+				return fmt.Errorf("redis error checking join request %v: %w", request.ID, err)
+			}
+			return nil
+		}
+
+		// MULTI: set status, add back to pending, or nil if aborted
+		if err = conn.Send("MULTI"); err != nil {
+			return fmt.Errorf("redis error sending `MULTI`: %w", err)
+		}
+		if err = conn.Send("HSET", joinRequestKey(request.ID),
+			"status", JoinStatusPending, "playerID", request.PlayerID,
+		); err != nil {
+			return fmt.Errorf("redis error sending `HSET` join request: %w", err)
+		}
+		if err = conn.Send("ZADD", "join-requests:"+request.GameID, request.Created, request.ID); err != nil {
+			return fmt.Errorf("redis error sending `ZADD` join request: %w", err)
+		}
+		_, err = redis.Ints(conn.Do("EXEC"))
+		if errors.Is(err, redis.ErrNil) {
+			return ErrTransactionAborted
+		} else if err != nil {
+			return fmt.Errorf("redis error sending `EXEC`: %w", err)
+		}
+		return nil
+	}
+	var err error
+	for i := 0; i < config.RedisRetries; i++ {
+		err = tryReopen()
+		if !errors.Is(err, ErrTransactionAborted) {
+			break
+		}
+	}
+	if errors.Is(err, ErrTransactionAborted) {
+		return fmt.Errorf("after max attempts: %w", err)
+	} else if err != nil {
+		return err
+	}
+	return publishJoinRequests(request.GameID, conn)
+}
+
+// RemoveJoinRequest deletes an answered join request once its requester has
+// seen the answer.
+func RemoveJoinRequest(requestID string, conn redis.Conn) error {
+	if _, err := conn.Do("DEL", joinRequestKey(requestID)); err != nil {
+		return fmt.Errorf("redis error deleting join request: %w", err)
+	}
+	return nil
+}
+
+// publishJoinRequests sends the pending join requests of a game to each player
+// in the game who can answer them.
+func publishJoinRequests(gameID string, conn redis.Conn) error {
+	requests, err := GetJoinRequests(gameID, conn)
+	if err != nil {
+		return err
+	}
+	updateBytes, err := json.Marshal(update.ForGameDiff(
+		map[string]interface{}{"pendingJoins": requests},
+	))
+	if err != nil {
+		return fmt.Errorf("marshal update to JSON: %w", err)
+	}
+	roles, err := GetRoles(gameID, conn)
+	if err != nil {
+		return err
+	}
+	for playerID, role := range roles {
+		if !role.Can(PermissionManagePlayers) {
+			continue
+		}
+		if _, err = conn.Do("PUBLISH", "update:"+playerID+":"+gameID, updateBytes); err != nil {
+			return fmt.Errorf("redis error publishing join requests: %w", err)
+		}
+	}
+	return nil
+}
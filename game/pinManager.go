@@ -0,0 +1,76 @@
+package game
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gomodule/redigo/redis"
+	"sr/id"
+	"sr/update"
+)
+
+// GetPins retrieves the IDs of the pinned events of a game, oldest pin first.
+func GetPins(gameID string, conn redis.Conn) ([]int64, error) {
+	pins, err := redis.Int64s(conn.Do("ZRANGE", "pins:"+gameID, 0, -1))
+	if err != nil {
+		return nil, fmt.Errorf("redis error getting pins: %w", err)
+	}
+	return pins, nil
+}
+
+// SetPinned pins or unpins an event for a game, and updates the game's
+// connected players if the pins changed.
+func SetPinned(gameID string, eventID int64, pinned bool, conn redis.Conn) (bool, error) {
+	return setListed("pins:"+gameID, "update:"+gameID, eventID, pinned, update.ForGamePins, conn)
+}
+
+// GetBookmarks retrieves the IDs of the events a player bookmarked in a game,
+// oldest bookmark first.
+func GetBookmarks(gameID string, playerID id.UID, conn redis.Conn) ([]int64, error) {
+	bookmarks, err := redis.Int64s(conn.Do(
+		"ZRANGE", "bookmarks:"+gameID+":"+string(playerID), 0, -1,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("redis error getting bookmarks: %w", err)
+	}
+	return bookmarks, nil
+}
+
+// SetBookmarked adds or removes a bookmark for a player in a game, and updates
+// the player's other connections if the bookmarks changed.
+func SetBookmarked(gameID string, playerID id.UID, eventID int64, bookmarked bool, conn redis.Conn) (bool, error) {
+	return setListed(
+		"bookmarks:"+gameID+":"+string(playerID),
+		"update:"+string(playerID)+":"+gameID,
+		eventID, bookmarked, update.ForBookmarks, conn,
+	)
+}
+
+// setListed adds or removes an event ID from a sorted set of event IDs, then
+// publishes the full list if it changed.
+func setListed(key string, channel string, eventID int64, listed bool, makeUpdate func([]int64) update.Game, conn redis.Conn) (bool, error) {
+	var changed int
+	var err error
+	if listed {
+		changed, err = redis.Int(conn.Do("ZADD", key, "NX", id.TimestampNow(), eventID))
+	} else {
+		changed, err = redis.Int(conn.Do("ZREM", key, eventID))
+	}
+	if err != nil {
+		return false, fmt.Errorf("redis error updating %v: %w", key, err)
+	}
+	if changed == 0 {
+		return false, nil
+	}
+	eventIDs, err := redis.Int64s(conn.Do("ZRANGE", key, 0, -1))
+	if err != nil {
+		return true, fmt.Errorf("redis error getting %v: %w", key, err)
+	}
+	updateBytes, err := json.Marshal(makeUpdate(eventIDs))
+	if err != nil {
+		return true, fmt.Errorf("unable to marshal update to JSON: %w", err)
+	}
+	if _, err = conn.Do("PUBLISH", channel, updateBytes); err != nil {
+		return true, fmt.Errorf("redis error publishing %v: %w", key, err)
+	}
+	return true, nil
+}
@@ -4,14 +4,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/gomodule/redigo/redis"
-	"log"
 	"sr/id"
 	"sr/player"
 	"sr/update"
 )
 
-// AddPlayer adds an existing player to a specific game
-func AddPlayer(gameID string, player *player.Player, conn redis.Conn) error {
+// AddPlayer adds an existing player to a specific game with the given role
+func AddPlayer(gameID string, player *player.Player, role Role, conn redis.Conn) error {
 	updateBytes, err := json.Marshal(update.ForPlayerAdd(player))
 	if err != nil {
 		return fmt.Errorf("marshal update to JSON: %w", err)
@@ -21,91 +20,123 @@ func AddPlayer(gameID string, player *player.Player, conn redis.Conn) error {
 		return fmt.Errorf("sending MULTI for player update: %w", err)
 	}
 	// Update game player list
-	if err = conn.Send("SADD", "players:"+gameID, player.ID); err != nil {
+	if err = conn.Send("HSET", "players:"+gameID, player.ID, role); err != nil {
+		return fmt.Errorf("sending HSET for player update: %w", err)
+	}
+	// Update player game list
+	if err = conn.Send("SADD", "games:"+string(player.ID), gameID); err != nil {
 		return fmt.Errorf("sending SADD for player update: %w", err)
 	}
 	// Send update
 	if err = conn.Send("PUBLISH", "update:"+gameID, updateBytes); err != nil {
 		return fmt.Errorf("sending PUBLISH for player update; %w", err)
 	}
-	// EXEC: [#added=1, #updated]
+	// EXEC: [#added=1, #games, #updated]
 	results, err := redis.Ints(conn.Do("EXEC"))
 	if err != nil {
 		return fmt.Errorf("redis error sending EXEC: %w", err)
 	}
-	if len(results) != 2 || results[0] != 1 {
+	if len(results) != 3 || results[0] != 1 {
 		return fmt.Errorf(
-			"redis invalid adding %v to %v: expected [1, *], got %v",
+			"redis invalid adding %v to %v: expected [1, *, *], got %v",
 			player, gameID, results,
 		)
 	}
 	return nil
 }
 
-// UpdatePlayerConnections tracks a player's online status, and updates the game accordingly
-func UpdatePlayerConnections(gameID string, playerID id.UID, mod int, conn redis.Conn) (int, error) {
-	newConns, err := player.ModifyConnections(playerID, mod, conn)
+// GetPlayerGames retrieves the IDs of the games a player is in.
+func GetPlayerGames(playerID id.UID, conn redis.Conn) ([]string, error) {
+	gameIDs, err := redis.Strings(conn.Do("SMEMBERS", "games:"+string(playerID)))
 	if err != nil {
-		return 0, fmt.Errorf("redis error updating connections for %v: %w", playerID, err)
-	}
-	// Race conditions
-	// - We assume that for each incr we will eventually send a decr.
-	// - We assume we have not sent a decr without having sent an incr.
-	// - Redis incr and decr are atomic, so we assume the sends will go through.
-	// - We DO NOT assume the sends will go through in order.
-	// - We assume the connection MAY drop below 0 if decrs are processed before incrs.
-	// We assume this may only happen in a sceario where an incrs will come through later
-	// and match the decrs; i.e. if we have observed connections < 0 we expect to settle on
-	// connections = 0. Because of this, we do not send updates for connections < 0.
-	var ud update.Player
-	// Decreasd to 0; going offline
-	if newConns == 0 && mod == player.DecreaseConnections {
-		ud = update.ForPlayerOnline(playerID, false)
-	} else if newConns == 1 && mod == player.IncreaseConnections {
-		ud = update.ForPlayerOnline(playerID, true)
-	} else {
-		log.Printf("Mod = %v, connections = %v, not sending an update", mod, newConns)
-		return newConns, nil
-	}
-	updateBytes, err := json.Marshal(ud)
+		return nil, fmt.Errorf("redis error getting games of %v: %w", playerID, err)
+	}
+	return gameIDs, nil
+}
+
+// IndexPlayerGames adds a game to the game lists of its players, for games
+// from before players' game lists. It returns the number of players whose
+// lists changed.
+func IndexPlayerGames(gameID string, conn redis.Conn) (int, error) {
+	playerIDs, err := redis.Strings(conn.Do("HKEYS", "players:"+gameID))
 	if err != nil {
-		return newConns, fmt.Errorf("unable to marshal %#v to JSON: %w", ud, err)
+		return 0, fmt.Errorf("redis error getting players in %v: %w", gameID, err)
 	}
-	if _, err = conn.Do("PUBLISH", "update:"+gameID, updateBytes); err != nil {
-		return newConns, fmt.Errorf("redis error publishing %#v: %w", ud, err)
+	indexed := 0
+	for _, playerID := range playerIDs {
+		added, err := redis.Int(conn.Do("SADD", "games:"+playerID, gameID))
+		if err != nil {
+			return indexed, fmt.Errorf("redis error indexing %v in %v: %w", playerID, gameID, err)
+		}
+		indexed += added
 	}
-	return newConns, nil
+	return indexed, nil
 }
 
-// UpdatePlayer updates a player in the database.
-// It does not allow for username updates. It only publishes the update to the given game.
-func UpdatePlayer(gameID string, playerID id.UID, externalUpdate update.Player, internalUpdate update.Player, conn redis.Conn) error {
-	if internalUpdate.IsEmpty() && externalUpdate.IsEmpty() {
-		return fmt.Errorf("external update %v empty and internal update %v empty", externalUpdate, internalUpdate)
-	}
-	// MULTI: update player, publish update
-	if err := conn.Send("MULTI"); err != nil {
+// UpdatePlayer updates a player in the database, and publishes the external
+// diff to each of the player's games. It does not allow for username updates.
+// If the internal diff changes the player's online mode, any change to whether
+// they're online or away is found and published separately for each game.
+func UpdatePlayer(plr *player.Player, externalDiff map[string]interface{}, internalDiff map[string]interface{}, conn redis.Conn) error {
+	if len(internalDiff) == 0 && len(externalDiff) == 0 {
+		return fmt.Errorf("external diff %v empty and internal diff %v empty", externalDiff, internalDiff)
+	}
+	gameIDs, err := GetPlayerGames(plr.ID, conn)
+	if err != nil {
+		return err
+	}
+	mode, modeChanged := internalDiff["onlineMode"].(player.OnlineMode)
+	gameUpdates := make(map[string][]byte, len(gameIDs))
+	for _, gameID := range gameIDs {
+		diff := make(map[string]interface{}, len(externalDiff)+2)
+		for key, value := range externalDiff {
+			diff[key] = value
+		}
+		if modeChanged {
+			previous := *plr
+			if previous.Connected, err = IsConnected(gameID, plr.ID, conn); err != nil {
+				return err
+			}
+			if previous.Idle, err = IsAway(gameID, plr.ID, conn); err != nil {
+				return err
+			}
+			updated := previous
+			updated.OnlineMode = mode
+			if previous.IsOnline() != updated.IsOnline() {
+				diff["online"] = updated.IsOnline()
+			}
+			if previous.IsAway() != updated.IsAway() {
+				diff["away"] = updated.IsAway()
+			}
+		}
+		if len(diff) == 0 {
+			continue
+		}
+		updateBytes, err := json.Marshal(update.ForPlayerDiff(plr.ID, diff))
+		if err != nil {
+			return fmt.Errorf("unable to marshal update to JSON :%w", err)
+		}
+		gameUpdates[gameID] = updateBytes
+	}
+
+	// MULTI: update player, publish update to each game
+	if err = conn.Send("MULTI"); err != nil {
 		return fmt.Errorf("redis error sending MULTI for player update: %w", err)
 	}
-	if !internalUpdate.IsEmpty() {
-		playerSet, playerData := internalUpdate.MakeRedisCommand()
+	if len(internalDiff) != 0 {
+		playerSet, playerData := update.ForPlayerDiff(plr.ID, internalDiff).MakeRedisCommand()
 		// Apply update to player
-		if err := conn.Send(playerSet, playerData...); err != nil {
+		if err = conn.Send(playerSet, playerData...); err != nil {
 			return fmt.Errorf("redis error sending HSET for player update: %w", err)
 		}
 	}
-	if !externalUpdate.IsEmpty() {
-		updateBytes, err := json.Marshal(externalUpdate)
-		if err != nil {
-			return fmt.Errorf("unable to marshal update to JSON :%w", err)
-		}
+	for gameID, updateBytes := range gameUpdates {
 		if err = conn.Send("PUBLISH", "update:"+gameID, updateBytes); err != nil {
 			return fmt.Errorf("redis error sending event publish: %w", err)
 		}
 	}
-	// EXEC: [0] for just internal, [#players] for just external, [#new=0, #players] for both
-	_, err := redis.Ints(conn.Do("EXEC"))
-	if err != nil {
+	// EXEC: [#new=0] if internal, [#players] for each game
+	if _, err = redis.Ints(conn.Do("EXEC")); err != nil {
 		return fmt.Errorf("redis error sending EXEC: %w", err)
 	}
 	return nil
@@ -0,0 +1,213 @@
+package game
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gomodule/redigo/redis"
+	"sr/config"
+	"sr/id"
+	"sr/player"
+	"sr/update"
+	"time"
+)
+
+// presenceKey is a sorted set of the players connected to a game, scored by
+// when their latest connection expires.
+func presenceKey(gameID string) string {
+	return "presence:" + gameID
+}
+
+// connectionsKey is a hash of a player's connections to a game, to the time
+// each expires. It expires after the player's last heartbeat.
+func connectionsKey(gameID string, playerID id.UID) string {
+	return "presence:" + gameID + ":" + string(playerID)
+}
+
+func nowMillis() int64 {
+	return time.Now().UnixNano() / int64(time.Millisecond)
+}
+
+// Heartbeat marks a player's connection to a game as alive for
+// config.PresenceSecs, publishing that the player came online if it was their
+// first connection. It also publishes that players whose connections all
+// expired without disconnecting, i.e. because their server crashed, went
+// offline.
+func Heartbeat(gameID string, playerID id.UID, connectionID string, conn redis.Conn) error {
+	now := nowMillis()
+	ttl := int64(config.PresenceSecs) * 1000
+	expires := now + ttl
+
+	// MULTI: get previous expiry, set connection, expire connections, set presence, expire presence
+	if err := conn.Send("MULTI"); err != nil {
+		return fmt.Errorf("redis error sending `MULTI`: %w", err)
+	}
+	if err := conn.Send("ZSCORE", presenceKey(gameID), playerID); err != nil {
+		return fmt.Errorf("redis error sending `ZSCORE` presence: %w", err)
+	}
+	if err := conn.Send("HSET", connectionsKey(gameID, playerID), connectionID, expires); err != nil {
+		return fmt.Errorf("redis error sending `HSET` connection: %w", err)
+	}
+	if err := conn.Send("PEXPIRE", connectionsKey(gameID, playerID), ttl); err != nil {
+		return fmt.Errorf("redis error sending `PEXPIRE` connections: %w", err)
+	}
+	if err := conn.Send("ZADD", presenceKey(gameID), expires, playerID); err != nil {
+		return fmt.Errorf("redis error sending `ZADD` presence: %w", err)
+	}
+	if err := conn.Send("PEXPIRE", presenceKey(gameID), ttl); err != nil {
+		return fmt.Errorf("redis error sending `PEXPIRE` presence: %w", err)
+	}
+	results, err := redis.Values(conn.Do("EXEC"))
+	if err != nil {
+		return fmt.Errorf("redis error sending `EXEC`: %w", err)
+	}
+	if len(results) != 5 {
+		return fmt.Errorf("redis invalid heartbeat for %v in %v: got %v", playerID, gameID, results)
+	}
+	previous, err := redis.Int64(results[0], nil)
+	if errors.Is(err, redis.ErrNil) {
+		previous = 0
+	} else if err != nil {
+		return fmt.Errorf("redis error parsing presence of %v: %w", playerID, err)
+	}
+	if previous < now {
+		if err = publishPresence(gameID, playerID, true, conn); err != nil {
+			return err
+		}
+	}
+	return sweepPresence(gameID, now, conn)
+}
+
+// Disconnect removes a player's connection to a game, publishing that the
+// player went offline if it was their last connection.
+func Disconnect(gameID string, playerID id.UID, connectionID string, conn redis.Conn) error {
+	if _, err := conn.Do("HDEL", connectionsKey(gameID, playerID), connectionID); err != nil {
+		return fmt.Errorf("redis error removing connection of %v: %w", playerID, err)
+	}
+	connections, err := redis.Int64Map(conn.Do("HGETALL", connectionsKey(gameID, playerID)))
+	if err != nil {
+		return fmt.Errorf("redis error getting connections of %v: %w", playerID, err)
+	}
+	now := nowMillis()
+	var latest int64
+	for _, expires := range connections {
+		if expires > latest {
+			latest = expires
+		}
+	}
+	if latest > now {
+		if _, err = conn.Do("ZADD", presenceKey(gameID), latest, playerID); err != nil {
+			return fmt.Errorf("redis error setting presence of %v: %w", playerID, err)
+		}
+		return nil
+	}
+
+	// MULTI: remove connections, remove presence
+	if err = conn.Send("MULTI"); err != nil {
+		return fmt.Errorf("redis error sending `MULTI`: %w", err)
+	}
+	if err = conn.Send("DEL", connectionsKey(gameID, playerID)); err != nil {
+		return fmt.Errorf("redis error sending `DEL` connections: %w", err)
+	}
+	if err = conn.Send("ZREM", presenceKey(gameID), playerID); err != nil {
+		return fmt.Errorf("redis error sending `ZREM` presence: %w", err)
+	}
+	// EXEC: [#deleted, #removed]
+	results, err := redis.Ints(conn.Do("EXEC"))
+	if err != nil {
+		return fmt.Errorf("redis error sending `EXEC`: %w", err)
+	}
+	if len(results) != 2 {
+		return fmt.Errorf("redis invalid disconnecting %v from %v: got %v", playerID, gameID, results)
+	}
+	// Only the request which removed the player announces it
+	if results[1] != 1 {
+		return nil
+	}
+	if err = clearActivity(gameID, playerID, conn); err != nil {
+		return err
+	}
+	return publishPresence(gameID, playerID, false, conn)
+}
+
+// sweepPresence removes players whose connections have all expired from a
+// game's presence, and publishes that they went offline.
+func sweepPresence(gameID string, now int64, conn redis.Conn) error {
+	expired, err := redis.Strings(conn.Do("ZRANGEBYSCORE", presenceKey(gameID), "-inf", now))
+	if err != nil {
+		return fmt.Errorf("redis error getting expired presence in %v: %w", gameID, err)
+	}
+	for _, playerID := range expired {
+		removed, err := redis.Int(conn.Do("ZREM", presenceKey(gameID), playerID))
+		if err != nil {
+			return fmt.Errorf("redis error removing presence of %v: %w", playerID, err)
+		}
+		if removed != 1 {
+			continue
+		}
+		if err = clearActivity(gameID, id.UID(playerID), conn); err != nil {
+			return err
+		}
+		if err = publishPresence(gameID, id.UID(playerID), false, conn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getOnlineMode retrieves whether a player chose to be shown as online.
+func getOnlineMode(playerID id.UID, conn redis.Conn) (player.OnlineMode, error) {
+	mode, err := redis.Int(conn.Do("HGET", "player:"+string(playerID), "onlineMode"))
+	if errors.Is(err, redis.ErrNil) {
+		return player.OnlineModeAuto, nil
+	} else if err != nil {
+		return 0, fmt.Errorf("redis error getting online mode of %v: %w", playerID, err)
+	}
+	return mode, nil
+}
+
+// publishPresence publishes that a player came online or went offline in a
+// game, unless they've chosen to always be shown as online or offline.
+func publishPresence(gameID string, playerID id.UID, online bool, conn redis.Conn) error {
+	mode, err := getOnlineMode(playerID, conn)
+	if err != nil {
+		return err
+	}
+	if mode != player.OnlineModeAuto && mode != player.OnlineModeAway {
+		return nil
+	}
+	updateBytes, err := json.Marshal(update.ForPlayerOnline(playerID, online))
+	if err != nil {
+		return fmt.Errorf("unable to marshal presence of %v to JSON: %w", playerID, err)
+	}
+	if _, err = conn.Do("PUBLISH", "update:"+gameID, updateBytes); err != nil {
+		return fmt.Errorf("redis error publishing presence of %v: %w", playerID, err)
+	}
+	return nil
+}
+
+// GetConnected retrieves the IDs of players connected to a game.
+func GetConnected(gameID string, conn redis.Conn) (map[id.UID]bool, error) {
+	playerIDs, err := redis.Strings(conn.Do(
+		"ZRANGEBYSCORE", presenceKey(gameID), fmt.Sprintf("(%v", nowMillis()), "+inf",
+	))
+	if err != nil {
+		return nil, fmt.Errorf("redis error getting presence in %v: %w", gameID, err)
+	}
+	connected := make(map[id.UID]bool, len(playerIDs))
+	for _, playerID := range playerIDs {
+		connected[id.UID(playerID)] = true
+	}
+	return connected, nil
+}
+
+// IsConnected determines if a player is connected to a game.
+func IsConnected(gameID string, playerID id.UID, conn redis.Conn) (bool, error) {
+	expires, err := redis.Int64(conn.Do("ZSCORE", presenceKey(gameID), playerID))
+	if errors.Is(err, redis.ErrNil) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("redis error getting presence of %v: %w", playerID, err)
+	}
+	return expires > nowMillis(), nil
+}
@@ -0,0 +1,275 @@
+package game
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gomodule/redigo/redis"
+	"sort"
+	"sr/event"
+	"sr/id"
+	"sr/update"
+)
+
+// Role is a player's role within a game, stored in `players:{gameID}`.
+type Role string
+
+// RoleOwner is the role of the player who created a game. It can do
+// everything a GM can, and assign GMs.
+const RoleOwner = Role("owner")
+
+// RoleGM is the role of game masters, who manage the game and its history.
+const RoleGM = Role("gm")
+
+// RolePlayer is the default role, for players who roll dice in a game.
+const RolePlayer = Role("player")
+
+// RoleSpectator is the role of players who can watch a game but not post.
+const RoleSpectator = Role("spectator")
+
+// ErrNotInGame means a player does not have a role in a game.
+var ErrNotInGame = errors.New("player not in game")
+
+// ErrInvalidRole means a role was not one of the known roles.
+var ErrInvalidRole = errors.New("invalid role")
+
+// IsRole determines if a string is a known role.
+func IsRole(role string) bool {
+	switch Role(role) {
+	case RoleOwner, RoleGM, RolePlayer, RoleSpectator:
+		return true
+	default:
+		return false
+	}
+}
+
+// Permission is something a role may be allowed to do within a game.
+type Permission int
+
+const (
+	// PermissionPost allows rolling dice, chatting, reacting and commenting,
+	// and editing or deleting one's own events.
+	PermissionPost Permission = iota
+	// PermissionModerate allows deleting or restoring any event in the game.
+	PermissionModerate
+	// PermissionPin allows pinning events for the whole game.
+	PermissionPin
+	// PermissionManageScenes allows starting and ending scenes.
+	PermissionManageScenes
+	// PermissionManagePlayers allows changing the roles of players and
+	// spectators.
+	PermissionManagePlayers
+	// PermissionAssignGMs allows making players GMs, or taking that away.
+	PermissionAssignGMs
+)
+
+// Can determines if the role has the given permission.
+func (r Role) Can(permission Permission) bool {
+	switch r {
+	case RoleOwner:
+		return true
+	case RoleGM:
+		return permission != PermissionAssignGMs
+	case RolePlayer:
+		return permission == PermissionPost
+	default:
+		return false
+	}
+}
+
+// GetRole retrieves a player's role in a game. It returns ErrNotInGame if the
+// player is not in the game.
+func GetRole(gameID string, playerID id.UID, conn redis.Conn) (Role, error) {
+	role, err := redis.String(conn.Do("HGET", "players:"+gameID, playerID))
+	if errors.Is(err, redis.ErrNil) {
+		return "", fmt.Errorf("%w: %v in %v", ErrNotInGame, playerID, gameID)
+	} else if err != nil {
+		return "", fmt.Errorf("redis error getting role of %v: %w", playerID, err)
+	}
+	return Role(role), nil
+}
+
+// GetRoles retrieves the roles of every player in a game.
+func GetRoles(gameID string, conn redis.Conn) (map[string]Role, error) {
+	roleTexts, err := redis.StringMap(conn.Do("HGETALL", "players:"+gameID))
+	if err != nil {
+		return nil, fmt.Errorf("redis error getting roles in %v: %w", gameID, err)
+	}
+	roles := make(map[string]Role, len(roleTexts))
+	for playerID, role := range roleTexts {
+		roles[playerID] = Role(role)
+	}
+	return roles, nil
+}
+
+// SetRole changes the role of a player already in a game, and updates the
+// game's connected players.
+func SetRole(gameID string, playerID id.UID, role Role, conn redis.Conn) error {
+	if !IsRole(string(role)) {
+		return fmt.Errorf("%w: %v", ErrInvalidRole, role)
+	}
+	if _, err := GetRole(gameID, playerID, conn); err != nil {
+		return err
+	}
+	updateBytes, err := json.Marshal(update.ForPlayerDiff(
+		playerID, map[string]interface{}{"role": role},
+	))
+	if err != nil {
+		return fmt.Errorf("marshal update to JSON: %w", err)
+	}
+
+	// MULTI: set role, publish update
+	if err = conn.Send("MULTI"); err != nil {
+		return fmt.Errorf("redis error sending `MULTI`: %w", err)
+	}
+	if err = conn.Send("HSET", "players:"+gameID, playerID, role); err != nil {
+		return fmt.Errorf("redis error sending `HSET` role: %w", err)
+	}
+	if err = conn.Send("PUBLISH", "update:"+gameID, updateBytes); err != nil {
+		return fmt.Errorf("redis error sending `PUBLISH` role: %w", err)
+	}
+	if _, err = conn.Do("EXEC"); err != nil {
+		return fmt.Errorf("redis error sending `EXEC`: %w", err)
+	}
+	return nil
+}
+
+// MigrateRoles converts a game's player list from a set of player IDs to a
+// hash of player roles. The game's owner gets RoleOwner and everyone else
+// RolePlayer. Games without an owner are given one, so they can be managed:
+// the earliest player to post in the game, or else the first player by ID.
+// Games which have already migrated are unchanged.
+func MigrateRoles(gameID string, conn redis.Conn) (bool, error) {
+	keyType, err := redis.String(conn.Do("TYPE", "players:"+gameID))
+	if err != nil {
+		return false, fmt.Errorf("redis error checking type of players: %w", err)
+	}
+	if keyType != "set" {
+		return false, nil
+	}
+	playerIDs, err := redis.Strings(conn.Do("SMEMBERS", "players:"+gameID))
+	if err != nil {
+		return false, fmt.Errorf("redis error getting players: %w", err)
+	}
+	owner, err := redis.String(conn.Do("HGET", "game:"+gameID, "owner"))
+	if err != nil && !errors.Is(err, redis.ErrNil) {
+		return false, fmt.Errorf("redis error getting owner: %w", err)
+	}
+	newOwner := false
+	if owner == "" || !containsString(playerIDs, owner) {
+		owner, err = earliestPoster(gameID, playerIDs, conn)
+		if err != nil {
+			return false, err
+		}
+		newOwner = owner != ""
+	}
+	roles := make(map[string]Role, len(playerIDs))
+	for _, playerID := range playerIDs {
+		roles[playerID] = RolePlayer
+		if playerID == owner {
+			roles[playerID] = RoleOwner
+		}
+	}
+
+	// MULTI: replace the set with the hash
+	if err = conn.Send("MULTI"); err != nil {
+		return false, fmt.Errorf("redis error sending `MULTI`: %w", err)
+	}
+	if err = conn.Send("DEL", "players:"+gameID); err != nil {
+		return false, fmt.Errorf("redis error sending `DEL`: %w", err)
+	}
+	if len(roles) != 0 {
+		if err = conn.Send("HSET", redis.Args{}.Add("players:"+gameID).AddFlat(roles)...); err != nil {
+			return false, fmt.Errorf("redis error sending `HSET`: %w", err)
+		}
+	}
+	if newOwner {
+		if err = conn.Send("HSET", "game:"+gameID, "owner", owner); err != nil {
+			return false, fmt.Errorf("redis error sending `HSET` owner: %w", err)
+		}
+	}
+	if _, err = conn.Do("EXEC"); err != nil {
+		return false, fmt.Errorf("redis error sending `EXEC`: %w", err)
+	}
+	return true, nil
+}
+
+// earliestPoster finds which of a game's players posted to it first, or the
+// first player by ID if none of them have posted. It returns "" if there are no
+// players.
+func earliestPoster(gameID string, playerIDs []string, conn redis.Conn) (string, error) {
+	if len(playerIDs) == 0 {
+		return "", nil
+	}
+	const pageSize = 100
+	for start := 0; ; start += pageSize {
+		eventTexts, err := redis.Strings(conn.Do(
+			"ZRANGE", "history:"+gameID, start, start+pageSize-1,
+		))
+		if err != nil {
+			return "", fmt.Errorf("redis error getting history of %v: %w", gameID, err)
+		}
+		for _, eventText := range eventTexts {
+			evt, err := event.Parse([]byte(eventText))
+			if err != nil {
+				continue
+			}
+			if playerID := string(evt.GetPlayerID()); containsString(playerIDs, playerID) {
+				return playerID, nil
+			}
+		}
+		if len(eventTexts) < pageSize {
+			break
+		}
+	}
+	sorted := append([]string(nil), playerIDs...)
+	sort.Strings(sorted)
+	return sorted[0], nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsSpectators determines if spectator sessions can watch a game.
+func AllowsSpectators(gameID string, conn redis.Conn) (bool, error) {
+	allowed, err := redis.Bool(conn.Do("HGET", "game:"+gameID, "spectators"))
+	if errors.Is(err, redis.ErrNil) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("redis error getting spectators: %w", err)
+	}
+	return allowed, nil
+}
+
+// SetAllowsSpectators allows or disallows spectator sessions from watching a
+// game, and updates the game's connected players. Existing spectator sessions
+// lose access when spectators are disallowed.
+func SetAllowsSpectators(gameID string, allowed bool, conn redis.Conn) error {
+	updateBytes, err := json.Marshal(update.ForGameDiff(
+		map[string]interface{}{"spectators": allowed},
+	))
+	if err != nil {
+		return fmt.Errorf("marshal update to JSON: %w", err)
+	}
+
+	// MULTI: set spectators, publish update
+	if err = conn.Send("MULTI"); err != nil {
+		return fmt.Errorf("redis error sending `MULTI`: %w", err)
+	}
+	if err = conn.Send("HSET", "game:"+gameID, "spectators", allowed); err != nil {
+		return fmt.Errorf("redis error sending `HSET` spectators: %w", err)
+	}
+	if err = conn.Send("PUBLISH", "update:"+gameID, updateBytes); err != nil {
+		return fmt.Errorf("redis error sending `PUBLISH` spectators: %w", err)
+	}
+	if _, err = conn.Do("EXEC"); err != nil {
+		return fmt.Errorf("redis error sending `EXEC`: %w", err)
+	}
+	return nil
+}
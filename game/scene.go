@@ -0,0 +1,190 @@
+package game
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gomodule/redigo/redis"
+	"sr/event"
+	"sr/player"
+)
+
+// ErrSceneActive means a scene was started while another was active.
+var ErrSceneActive = errors.New("a scene is already active")
+
+// ErrNoActiveScene means a scene was ended while none was active.
+var ErrNoActiveScene = errors.New("no scene is active")
+
+// ErrSceneNotFound means a requested scene does not exist.
+var ErrSceneNotFound = errors.New("scene not found")
+
+// Scene is a named section of a game's history, such as a single run.
+// The ID of a scene is the ID of its `SceneStart` event, which is also
+// its start time.
+type Scene struct {
+	ID     int64  `json:"id" redis:"-"`
+	Title  string `json:"title" redis:"title"`
+	End    int64  `json:"end,omitempty" redis:"end"`
+	Events int    `json:"events" redis:"-"`
+}
+
+// Newest gives the newest event ID which may be in the scene.
+func (s *Scene) Newest() string {
+	if s.End == 0 {
+		return "+inf"
+	}
+	return fmt.Sprintf("%v", s.End)
+}
+
+func sceneKey(gameID string, sceneID int64) string {
+	return fmt.Sprintf("scene:%v:%v", gameID, sceneID)
+}
+
+// GetActiveSceneID retrieves the ID of the active scene in a game, or 0 if
+// there is no active scene.
+func GetActiveSceneID(gameID string, conn redis.Conn) (int64, error) {
+	sceneID, err := redis.Int64(conn.Do("HGET", "game:"+gameID, "scene"))
+	if errors.Is(err, redis.ErrNil) {
+		return 0, nil
+	} else if err != nil {
+		return 0, fmt.Errorf("redis error getting active scene: %w", err)
+	}
+	return sceneID, nil
+}
+
+// GetScene retrieves a scene of a game, including its count of events shared
+// with the game. Private and GM-only events aren't counted, since everyone in
+// the game can see the count.
+func GetScene(gameID string, sceneID int64, conn redis.Conn) (*Scene, error) {
+	data, err := redis.Values(conn.Do("HGETALL", sceneKey(gameID, sceneID)))
+	if err != nil {
+		return nil, fmt.Errorf("redis error getting scene %v: %w", sceneID, err)
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("%w: %v in %v", ErrSceneNotFound, sceneID, gameID)
+	}
+	scene := Scene{ID: sceneID}
+	if err = redis.ScanStruct(data, &scene); err != nil {
+		return nil, fmt.Errorf("redis error parsing scene %v: %w", sceneID, err)
+	}
+	scene.Events, err = countSharedEvents(gameID, sceneID, scene.Newest(), conn)
+	if err != nil {
+		return nil, fmt.Errorf("counting events in scene %v: %w", sceneID, err)
+	}
+	return &scene, nil
+}
+
+// countSharedEvents counts the events shared with a game between the oldest
+// and newest IDs, a page at a time.
+func countSharedEvents(gameID string, oldest int64, newest string, conn redis.Conn) (int, error) {
+	const pageSize = 100
+	count := 0
+	from := fmt.Sprintf("%v", oldest)
+	for {
+		eventTexts, err := redis.ByteSlices(conn.Do(
+			"ZRANGEBYSCORE", "history:"+gameID, from, newest, "LIMIT", 0, pageSize,
+		))
+		if err != nil {
+			return 0, fmt.Errorf("redis error getting events after %v: %w", from, err)
+		}
+		for _, eventText := range eventTexts {
+			var evt struct {
+				ID    int64 `json:"id"`
+				Share int   `json:"share"`
+			}
+			if err = json.Unmarshal(eventText, &evt); err != nil {
+				return 0, fmt.Errorf("parsing event after %v: %w", from, err)
+			}
+			if event.Share(evt.Share) == event.ShareInGame {
+				count++
+			}
+			from = fmt.Sprintf("(%v", evt.ID)
+		}
+		if len(eventTexts) < pageSize {
+			return count, nil
+		}
+	}
+}
+
+// GetScenes retrieves all of the scenes of a game, oldest first.
+func GetScenes(gameID string, conn redis.Conn) ([]Scene, error) {
+	sceneIDs, err := redis.Int64s(conn.Do("ZRANGE", "scenes:"+gameID, 0, -1))
+	if err != nil {
+		return nil, fmt.Errorf("redis error getting scene list: %w", err)
+	}
+	scenes := make([]Scene, len(sceneIDs))
+	for i, sceneID := range sceneIDs {
+		scene, err := GetScene(gameID, sceneID, conn)
+		if err != nil {
+			return nil, fmt.Errorf("getting scene #%v: %w", i, err)
+		}
+		scenes[i] = *scene
+	}
+	return scenes, nil
+}
+
+// StartScene begins a new scene in a game and posts its `SceneStart` event.
+// Events posted in the game are tagged with the scene until it is ended.
+func StartScene(gameID string, plr *player.Player, title string, conn redis.Conn) (*event.SceneStart, error) {
+	start := event.ForSceneStart(plr, title)
+	sceneID := start.GetID()
+
+	set, err := redis.Int(conn.Do("HSETNX", "game:"+gameID, "scene", sceneID))
+	if err != nil {
+		return nil, fmt.Errorf("redis error setting active scene: %w", err)
+	}
+	if set != 1 {
+		return nil, ErrSceneActive
+	}
+
+	// MULTI: add scene to list, set scene info
+	if err = conn.Send("MULTI"); err != nil {
+		return nil, fmt.Errorf("redis error sending `MULTI`: %w", err)
+	}
+	if err = conn.Send("ZADD", "scenes:"+gameID, sceneID, sceneID); err != nil {
+		return nil, fmt.Errorf("redis error sending `ZADD` scene: %w", err)
+	}
+	if err = conn.Send("HSET", sceneKey(gameID, sceneID), "title", title); err != nil {
+		return nil, fmt.Errorf("redis error sending `HSET` scene: %w", err)
+	}
+	if _, err = conn.Do("EXEC"); err != nil {
+		return nil, fmt.Errorf("redis error sending `EXEC`: %w", err)
+	}
+
+	if err = postEvent(gameID, &start, conn); err != nil {
+		return nil, fmt.Errorf("posting scene start: %w", err)
+	}
+	return &start, nil
+}
+
+// EndScene ends the active scene of a game and posts its `SceneEnd` event.
+func EndScene(gameID string, plr *player.Player, conn redis.Conn) (*event.SceneEnd, error) {
+	sceneID, err := GetActiveSceneID(gameID, conn)
+	if err != nil {
+		return nil, err
+	}
+	if sceneID == 0 {
+		return nil, ErrNoActiveScene
+	}
+	scene, err := GetScene(gameID, sceneID, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	removed, err := redis.Int(conn.Do("HDEL", "game:"+gameID, "scene"))
+	if err != nil {
+		return nil, fmt.Errorf("redis error removing active scene: %w", err)
+	}
+	if removed != 1 {
+		return nil, ErrNoActiveScene
+	}
+
+	end := event.ForSceneEnd(plr, sceneID, scene.Title)
+	if _, err = conn.Do("HSET", sceneKey(gameID, sceneID), "end", end.GetID()); err != nil {
+		return nil, fmt.Errorf("redis error setting scene end: %w", err)
+	}
+	if err = postEvent(gameID, &end, conn); err != nil {
+		return nil, fmt.Errorf("posting scene end: %w", err)
+	}
+	return &end, nil
+}
@@ -0,0 +1,227 @@
+package game
+
+import (
+	"fmt"
+	"github.com/gomodule/redigo/redis"
+	"sr"
+	"sr/config"
+	"sr/event"
+	"sr/id"
+	"strings"
+)
+
+// Stats are the dice statistics of a player, or of a whole game.
+type Stats struct {
+	Rolls            int `json:"rolls"`
+	Dice             int `json:"dice"`
+	Hits             int `json:"hits"`
+	Glitches         int `json:"glitches"`
+	CriticalGlitches int `json:"criticalGlitches"`
+	Edge             int `json:"edge"`
+	Initiatives      int `json:"initiatives"`
+	InitiativeTotal  int `json:"initiativeTotal"`
+}
+
+// HitRate is the fraction of rolled dice which were hits.
+func (s *Stats) HitRate() float64 {
+	if s.Dice == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Dice)
+}
+
+// AverageInitiative is the mean result of initiative rolls.
+func (s *Stats) AverageInitiative() float64 {
+	if s.Initiatives == 0 {
+		return 0
+	}
+	return float64(s.InitiativeTotal) / float64(s.Initiatives)
+}
+
+// add adds a counter to the stats by its redis field name.
+func (s *Stats) add(stat string, value int) {
+	switch stat {
+	case "rolls":
+		s.Rolls += value
+	case "dice":
+		s.Dice += value
+	case "hits":
+		s.Hits += value
+	case "glitches":
+		s.Glitches += value
+	case "criticalGlitches":
+		s.CriticalGlitches += value
+	case "edge":
+		s.Edge += value
+	case "initiatives":
+		s.Initiatives += value
+	case "initiativeTotal":
+		s.InitiativeTotal += value
+	}
+}
+
+// eventStats gives the counters an event adds to its player's stats. Events
+// not shared with the game are not counted, since stats are shown to everyone.
+func eventStats(evt event.Event) map[string]int {
+	stats := make(map[string]int)
+	if evt.GetShare() != event.ShareInGame {
+		return stats
+	}
+	switch evt.(type) {
+	case *event.Reroll:
+		// Legacy rerolls replaced their original roll, so count the dice too.
+		stats["edge"] = 1
+	case *event.Roll:
+		if len(evt.(*event.Roll).Reroll) != 0 {
+			stats["edge"] = 1
+		}
+	case *event.EdgeRoll:
+		stats["edge"] = 1
+	case *event.InitiativeRoll:
+		initiative := evt.(*event.InitiativeRoll)
+		stats["initiatives"] = 1
+		stats["initiativeTotal"] = initiative.Base + sr.SumRolls(initiative.Dice)
+		if initiative.Seized || initiative.Blitzed {
+			stats["edge"] = 1
+		}
+		return stats
+	}
+	dice, glitchy, ok := event.FinalDice(evt)
+	if !ok {
+		return stats
+	}
+	stats["rolls"] = 1
+	stats["dice"] = len(dice)
+	stats["hits"] = sr.CountHits(dice)
+	if sr.IsCriticalGlitch(dice, glitchy) {
+		stats["criticalGlitches"] = 1
+	} else if sr.IsGlitched(dice, glitchy) {
+		stats["glitches"] = 1
+	}
+	return stats
+}
+
+// statsField is the field of a player's counter in `stats:{gameID}`.
+func statsField(playerID id.UID, stat string) string {
+	return string(playerID) + ":" + stat
+}
+
+// sendStats sends `HINCRBY`s which add (or with a negative sign, remove) an
+// event's counters, for use within a `MULTI`. It returns the number of
+// commands sent.
+func sendStats(gameID string, evt event.Event, sign int, conn redis.Conn) (int, error) {
+	sent := 0
+	for stat, value := range eventStats(evt) {
+		if value == 0 {
+			continue
+		}
+		err := conn.Send("HINCRBY", "stats:"+gameID, statsField(evt.GetPlayerID(), stat), sign*value)
+		if err != nil {
+			return sent, fmt.Errorf("redis error sending `HINCRBY` %v: %w", stat, err)
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+// sendStatsChange sends the `HINCRBY`s needed to replace an event's counters
+// with those of its new version, for use within a `MULTI`. It returns the
+// number of commands sent.
+func sendStatsChange(gameID string, oldEvent event.Event, newEvent event.Event, conn redis.Conn) (int, error) {
+	changes := eventStats(newEvent)
+	for stat, value := range eventStats(oldEvent) {
+		changes[stat] -= value
+	}
+	sent := 0
+	for stat, value := range changes {
+		if value == 0 {
+			continue
+		}
+		err := conn.Send("HINCRBY", "stats:"+gameID, statsField(newEvent.GetPlayerID(), stat), value)
+		if err != nil {
+			return sent, fmt.Errorf("redis error sending `HINCRBY` %v: %w", stat, err)
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+// GetStats retrieves the stats of each player who has rolled in a game.
+func GetStats(gameID string, conn redis.Conn) (map[id.UID]*Stats, error) {
+	counters, err := redis.IntMap(conn.Do("HGETALL", "stats:"+gameID))
+	if err != nil {
+		return nil, fmt.Errorf("redis error getting stats: %w", err)
+	}
+	stats := make(map[id.UID]*Stats)
+	for field, value := range counters {
+		split := strings.LastIndex(field, ":")
+		if split == -1 {
+			return nil, fmt.Errorf("invalid stats field %v", field)
+		}
+		playerID := id.UID(field[:split])
+		if stats[playerID] == nil {
+			stats[playerID] = &Stats{}
+		}
+		stats[playerID].add(field[split+1:], value)
+	}
+	return stats, nil
+}
+
+// RebuildStats recomputes a game's stats from its full history, for games
+// whose history predates the counters.
+func RebuildStats(gameID string, conn redis.Conn) error {
+	counters := make(map[string]int)
+	oldest := "-inf"
+	for {
+		events, err := event.GetNewerThan(gameID, oldest, config.MaxEventRange, conn)
+		if err != nil {
+			return fmt.Errorf("getting events newer than %v: %w", oldest, err)
+		}
+		for i, eventText := range events {
+			evt, err := event.Parse([]byte(eventText))
+			if err != nil {
+				return fmt.Errorf("parsing event #%v, %v: %w", i, eventText, err)
+			}
+			oldest = fmt.Sprintf("(%v", evt.GetID())
+			for stat, value := range eventStats(evt) {
+				counters[statsField(evt.GetPlayerID(), stat)] += value
+			}
+		}
+		if len(events) < config.MaxEventRange {
+			break
+		}
+	}
+
+	// MULTI: replace the stats
+	if err := conn.Send("MULTI"); err != nil {
+		return fmt.Errorf("redis error sending `MULTI`: %w", err)
+	}
+	if err := conn.Send("DEL", "stats:"+gameID); err != nil {
+		return fmt.Errorf("redis error sending `DEL`: %w", err)
+	}
+	if len(counters) != 0 {
+		if err := conn.Send("HSET", redis.Args{}.Add("stats:"+gameID).AddFlat(counters)...); err != nil {
+			return fmt.Errorf("redis error sending `HSET`: %w", err)
+		}
+	}
+	if _, err := conn.Do("EXEC"); err != nil {
+		return fmt.Errorf("redis error sending `EXEC`: %w", err)
+	}
+	return nil
+}
+
+// TotalStats adds up the stats of every player in a game.
+func TotalStats(stats map[id.UID]*Stats) *Stats {
+	var total Stats
+	for _, playerStats := range stats {
+		total.Rolls += playerStats.Rolls
+		total.Dice += playerStats.Dice
+		total.Hits += playerStats.Hits
+		total.Glitches += playerStats.Glitches
+		total.CriticalGlitches += playerStats.CriticalGlitches
+		total.Edge += playerStats.Edge
+		total.Initiatives += playerStats.Initiatives
+		total.InitiativeTotal += playerStats.InitiativeTotal
+	}
+	return &total
+}
@@ -20,7 +20,11 @@ const MessageTypeEvent MessageType = MessageType(1)
 // MessageTypeUpdate is sent for an update
 const MessageTypeUpdate MessageType = MessageType(2)
 
-// Message is either an event or update
+// MessageTypeClose is sent when the subscription should be closed, with the
+// reason as its body
+const MessageTypeClose MessageType = MessageType(3)
+
+// Message is either an event or update, or a request to close
 type Message struct {
 	Type MessageType
 	Body string
@@ -55,6 +59,8 @@ func subscribeTask(ctx context.Context, cleanup func(), messages chan Message, e
 			messageText := string(msg.Data)
 			if strings.HasPrefix(msg.Channel, "history") {
 				message = Message{Type: MessageTypeEvent, Body: messageText}
+			} else if strings.HasPrefix(msg.Channel, "close") {
+				message = Message{Type: MessageTypeClose, Body: messageText}
 			} else {
 				message = Message{Type: MessageTypeUpdate, Body: messageText}
 			}
@@ -70,7 +76,8 @@ func subscribeTask(ctx context.Context, cleanup func(), messages chan Message, e
 // Subscribe runs a task in a separate goroutine that will send new `Message`s to the `messages` channel
 // and errors to the error channel. Both channels will be closed upon completion.
 // ctx is used to cancel the remote task and must also have been initialized with a redis connection.
-func Subscribe(ctx context.Context, gameID string, playerID id.UID, messages chan Message, errors chan error) error {
+// Messages published to sessionClose are sent as MessageTypeClose, like when the player is removed.
+func Subscribe(ctx context.Context, gameID string, playerID id.UID, sessionClose string, messages chan Message, errors chan error) error {
 	conn, err := redisUtil.ConnectWithContext(ctx)
 	if err != nil {
 		close(errors)
@@ -92,6 +99,7 @@ func Subscribe(ctx context.Context, gameID string, playerID id.UID, messages cha
 	if err := sub.Subscribe(
 		"history:"+gameID, "history:"+string(playerID)+":"+gameID,
 		"update:"+gameID, "update:"+string(playerID)+":"+gameID,
+		closeChannel(gameID, playerID), sessionClose,
 	); err != nil {
 		cleanup()
 		return fmt.Errorf("subscribing to events and history: %w", err)
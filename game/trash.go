@@ -0,0 +1,186 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gomodule/redigo/redis"
+	"sort"
+	"sr/config"
+	"sr/event"
+	"sr/id"
+	"time"
+)
+
+// ErrNotInTrash means a deleted event was not found in a game's trash.
+var ErrNotInTrash = errors.New("event not in trash")
+
+// TrashedEvent is an event which was deleted from a game's history.
+type TrashedEvent struct {
+	Event     event.Event `json:"event"`
+	DeletedAt int64       `json:"deletedAt"`
+}
+
+// expireTrash permanently removes events which have been in the trash for
+// longer than the retention window.
+func expireTrash(gameID string, conn redis.Conn) error {
+	retention := time.Duration(config.TrashRetentionHours) * time.Hour
+	cutoff := id.TimestampNow() - retention.Milliseconds()
+	expired, err := redis.Int64s(conn.Do(
+		"ZRANGEBYSCORE", "trashed:"+gameID, "-inf", cutoff,
+	))
+	if err != nil {
+		return fmt.Errorf("redis error finding expired trash: %w", err)
+	}
+	if len(expired) == 0 {
+		return nil
+	}
+
+	// MULTI: remove trashed events, their trash times, and their revisions
+	if err = conn.Send("MULTI"); err != nil {
+		return fmt.Errorf("redis error sending `MULTI`: %w", err)
+	}
+	if err = conn.Send("HDEL", redis.Args{}.Add("trash:"+gameID).AddFlat(expired)...); err != nil {
+		return fmt.Errorf("redis error sending `HDEL`: %w", err)
+	}
+	if err = conn.Send("ZREMRANGEBYSCORE", "trashed:"+gameID, "-inf", cutoff); err != nil {
+		return fmt.Errorf("redis error sending `ZREMRANGEBYSCORE`: %w", err)
+	}
+	for _, eventID := range expired {
+		if err = conn.Send("DEL", event.RevisionsKey(gameID, eventID)); err != nil {
+			return fmt.Errorf("redis error sending `DEL` revisions of %v: %w", eventID, err)
+		}
+	}
+	if _, err = conn.Do("EXEC"); err != nil {
+		return fmt.Errorf("redis error sending `EXEC`: %w", err)
+	}
+	return nil
+}
+
+// GetTrash retrieves the events deleted from a game within the retention
+// window, most recently deleted first.
+func GetTrash(gameID string, conn redis.Conn) ([]TrashedEvent, error) {
+	if err := expireTrash(gameID, conn); err != nil {
+		return nil, fmt.Errorf("expiring trash: %w", err)
+	}
+	eventTexts, err := redis.StringMap(conn.Do("HGETALL", "trash:"+gameID))
+	if err != nil {
+		return nil, fmt.Errorf("redis error getting trash: %w", err)
+	}
+	deletedTimes, err := redis.Int64Map(conn.Do(
+		"ZRANGE", "trashed:"+gameID, 0, -1, "WITHSCORES",
+	))
+	if err != nil {
+		return nil, fmt.Errorf("redis error getting trash times: %w", err)
+	}
+
+	trash := make([]TrashedEvent, 0, len(eventTexts))
+	for eventID, eventText := range eventTexts {
+		evt, err := event.Parse([]byte(eventText))
+		if err != nil {
+			return nil, fmt.Errorf("parsing trashed event %v: %w", eventID, err)
+		}
+		trash = append(trash, TrashedEvent{
+			Event:     evt,
+			DeletedAt: deletedTimes[eventID],
+		})
+	}
+	sort.Slice(trash, func(i, j int) bool {
+		return trash[i].DeletedAt > trash[j].DeletedAt
+	})
+	return trash, nil
+}
+
+// GetTrashedEvent retrieves a single event from a game's trash.
+func GetTrashedEvent(gameID string, eventID int64, conn redis.Conn) (event.Event, error) {
+	if err := expireTrash(gameID, conn); err != nil {
+		return nil, fmt.Errorf("expiring trash: %w", err)
+	}
+	eventText, err := redis.Bytes(conn.Do("HGET", "trash:"+gameID, eventID))
+	if errors.Is(err, redis.ErrNil) {
+		return nil, fmt.Errorf("%w: %v in %v", ErrNotInTrash, eventID, gameID)
+	} else if err != nil {
+		return nil, fmt.Errorf("redis error getting trashed event %v: %w", eventID, err)
+	}
+	return event.Parse(eventText)
+}
+
+// RestoreEvent moves an event from a game's trash back into its history at
+// its original ID, and sends it to the game's connected players. It returns
+// ErrNotInTrash if the event has already left the trash.
+func RestoreEvent(gameID string, eventID int64, conn redis.Conn) error {
+	if err := expireTrash(gameID, conn); err != nil {
+		return fmt.Errorf("expiring trash: %w", err)
+	}
+	tryRestore := func() error {
+		if _, err := conn.Do("WATCH", "trash:"+gameID, "history:"+gameID); err != nil {
+			return fmt.Errorf("redis error sending `WATCH`: %w", err)
+		}
+		eventBytes, err := redis.Bytes(conn.Do("HGET", "trash:"+gameID, eventID))
+		if errors.Is(err, redis.ErrNil) {
+			err = fmt.Errorf("%w: %v in %v", ErrNotInTrash, eventID, gameID)
+		} else if err != nil {
+			err = fmt.Errorf("redis error getting trashed event %v: %w", eventID, err)
+		}
+		var evt event.Event
+		if err == nil {
+			evt, err = event.Parse(eventBytes)
+		}
+		var taken int
+		if err == nil {
+			taken, err = redis.Int(conn.Do("ZCOUNT", "history:"+gameID, eventID, eventID))
+			if err != nil {
+				err = fmt.Errorf("redis error checking for event ID %v: %w", eventID, err)
+			} else if taken != 0 {
+				err = fmt.Errorf("restoring %v: an event with that ID already exists", eventID)
+			}
+		}
+		if err != nil {
+			if _, unwatchErr := conn.Do("UNWATCH"); unwatchErr != nil {
+				return fmt.Errorf("redis error sending `UNWATCH`: %w", unwatchErr)
+			}
+			return err
+		}
+		channel := EventChannel(gameID, evt)
+
+		// MULTI: add event back, remove from trash, publish event, or nil if aborted
+		if err = conn.Send("MULTI"); err != nil {
+			return fmt.Errorf("redis error initiating event restore: %w", err)
+		}
+		if err = conn.Send("ZADD", "history:"+gameID, "NX", eventID, eventBytes); err != nil {
+			return fmt.Errorf("redis error sending add event to history: %w", err)
+		}
+		if err = conn.Send("HDEL", "trash:"+gameID, eventID); err != nil {
+			return fmt.Errorf("redis error sending remove event from trash: %w", err)
+		}
+		if err = conn.Send("ZREM", "trashed:"+gameID, eventID); err != nil {
+			return fmt.Errorf("redis error sending remove event trash time: %w", err)
+		}
+		if err = conn.Send("PUBLISH", channel, eventBytes); err != nil {
+			return fmt.Errorf("redis error sending publish event: %w", err)
+		}
+		statCount, err := sendStats(gameID, evt, 1, conn)
+		if err != nil {
+			return err
+		}
+
+		// EXEC: [#added=1, #removed=1, #removed=1, #players, stats...]
+		results, err := redis.Ints(conn.Do("EXEC"))
+		if errors.Is(err, redis.ErrNil) {
+			return ErrTransactionAborted
+		} else if err != nil {
+			return fmt.Errorf("redis error EXECing event restore: %w", err)
+		}
+		if len(results) != 4+statCount || results[0] != 1 || results[1] != 1 {
+			return fmt.Errorf("redis error restoring event, expected [1, 1, *, *], got %v", results)
+		}
+		return nil
+	}
+	var err error
+	for i := 0; i < config.RedisRetries; i++ {
+		err = tryRestore()
+		if !errors.Is(err, ErrTransactionAborted) {
+			return err
+		}
+	}
+	return fmt.Errorf("after max attempts: %w", err)
+}
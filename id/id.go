@@ -25,6 +25,18 @@ func GenUID() UID {
 	return UID(encodeBytes(9))
 }
 
+// GenGameID creates a new random game ID, long enough that games can't be
+// found by guessing.
+func GenGameID() GameID {
+	return GameID(encodeBytes(9))
+}
+
+// GenInviteCode creates a new random invite code, short enough to share by
+// reading it aloud.
+func GenInviteCode() string {
+	return encodeBytes(6)
+}
+
 // GenSessionID generates a session UID, longer than the default.
 func GenSessionID() UID {
 	return UID(encodeBytes(12))
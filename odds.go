@@ -0,0 +1,181 @@
+package sr
+
+import (
+	"errors"
+)
+
+/*
+   Roll Odds
+
+   Odds are computed exactly (up to float precision) by convolving the
+   distribution of a single die over the pool, rather than by simulation.
+
+   - Normal rolls: each die hits on 5 or 6 (1/3) and is a 1 on 1/6.
+   - Second Chance: misses are rerolled once, so each die hits 1/3 + 2/3 * 1/3
+     = 5/9 of the time and ends as a 1 on 2/3 * 1/6 = 1/9.
+   - Rule of Six: each 6 is a hit and adds another die. Explosions are cut off
+     after maxExplosions sixes in a row, which drops less than 1e-15 of the
+     probability per die.
+
+   Glitches follow `IsGlitched`, so with the Rule of Six the extra dice count
+   towards the size of the pool.
+*/
+
+// Odds are the probabilities of the outcomes of rolling a dice pool.
+type Odds struct {
+	// Hits is the probability of getting exactly that many hits.
+	Hits []float64 `json:"hits"`
+	// AtLeast is the probability of getting that many hits or more.
+	AtLeast []float64 `json:"atLeast"`
+	// ExpectedHits is the average number of hits.
+	ExpectedHits float64 `json:"expectedHits"`
+	// Glitch is the probability of a glitch, including critical glitches.
+	Glitch float64 `json:"glitch"`
+	// CriticalGlitch is the probability of a glitch with no hits.
+	CriticalGlitch float64 `json:"criticalGlitch"`
+}
+
+// ErrInvalidOdds means the odds of a roll which can't be made were requested.
+var ErrInvalidOdds = errors.New("invalid roll for odds")
+
+// maxExplosions is the most sixes in a row considered for one die.
+const maxExplosions = 20
+
+// oddsEpsilon is the smallest probability kept at the end of distributions.
+const oddsEpsilon = 1e-12
+
+// RollOdds computes the odds of rolling pool dice.
+//
+// edge applies the Rule of Six and ignores limit, as when pushing the limit.
+// secondChance rerolls the misses, and can't be used with edge. A limit above
+// zero caps the hits counted. glitchy adds to the 1s counted for glitches.
+func RollOdds(pool int, edge bool, secondChance bool, glitchy int, limit int) (*Odds, error) {
+	if pool < 1 {
+		return nil, ErrInvalidOdds
+	}
+	if edge && secondChance {
+		return nil, ErrInvalidOdds
+	}
+	if limit < 0 {
+		return nil, ErrInvalidOdds
+	}
+
+	var odds Odds
+	if edge {
+		odds.Hits = trimOdds(convolvePool(explodingHits(), pool))
+		odds.Glitch = explodingGlitch(pool, glitchy)
+	} else {
+		pHit, pOne := 1.0/3, 1.0/6
+		if secondChance {
+			pHit, pOne = 5.0/9, 1.0/9
+		}
+		odds.Hits = convolvePool([]float64{1 - pHit, pHit}, pool)
+		ones := convolvePool([]float64{1 - pOne, pOne}, pool)
+		odds.Glitch = sumGlitches(ones, pool, glitchy)
+		if limit > 0 && limit < len(odds.Hits)-1 {
+			for hits := limit + 1; hits < len(odds.Hits); hits++ {
+				odds.Hits[limit] += odds.Hits[hits]
+			}
+			odds.Hits = odds.Hits[:limit+1]
+		}
+	}
+	odds.CriticalGlitch = criticalGlitch(pool, glitchy, secondChance)
+
+	odds.AtLeast = make([]float64, len(odds.Hits))
+	total := 0.0
+	for hits := len(odds.Hits) - 1; hits >= 0; hits-- {
+		total += odds.Hits[hits]
+		odds.AtLeast[hits] = total
+		odds.ExpectedHits += float64(hits) * odds.Hits[hits]
+	}
+	return &odds, nil
+}
+
+// convolvePool gives the distribution of the sum of pool independent dice,
+// each of which has the given distribution.
+func convolvePool(die []float64, pool int) []float64 {
+	result := []float64{1}
+	for i := 0; i < pool; i++ {
+		next := make([]float64, len(result)+len(die)-1)
+		for total, p := range result {
+			for value, q := range die {
+				next[total+value] += p * q
+			}
+		}
+		result = next
+	}
+	return result
+}
+
+// trimOdds removes negligible probabilities from the end of a distribution.
+func trimOdds(odds []float64) []float64 {
+	end := len(odds)
+	for end > 1 && odds[end-1] < oddsEpsilon {
+		end--
+	}
+	return odds[:end]
+}
+
+// explodingHits is the distribution of hits from a single die with the Rule
+// of Six: k sixes followed by a 5 or k sixes followed by a 1 - 4.
+func explodingHits() []float64 {
+	hits := make([]float64, maxExplosions+1)
+	six := 1.0
+	for sixes := 0; sixes <= maxExplosions; sixes++ {
+		hits[sixes] += six * 4 / 6
+		if sixes < maxExplosions {
+			hits[sixes+1] += six / 6
+		}
+		six /= 6
+	}
+	return hits
+}
+
+// explodingGlitch is the probability of a glitch with the Rule of Six.
+//
+// A roll glitches when 2 * (ones + glitchy) > pool + sixes, since each six
+// adds a die. Each die's contribution to 2 * ones - sixes is tracked, with
+// the possible values offset to be non-negative.
+func explodingGlitch(pool int, glitchy int) float64 {
+	// One die ends with k sixes and then a 1 (+2 - k), or a 2 - 5 (-k).
+	die := make([]float64, maxExplosions+3)
+	six := 1.0
+	for sixes := 0; sixes <= maxExplosions; sixes++ {
+		die[maxExplosions-sixes+2] += six / 6
+		die[maxExplosions-sixes] += six * 4 / 6
+		six /= 6
+	}
+	totals := convolvePool(die, pool)
+	// Each die's value is offset by maxExplosions
+	offset := pool * maxExplosions
+	glitch := 0.0
+	for total, p := range totals {
+		if total-offset > pool-2*glitchy {
+			glitch += p
+		}
+	}
+	return glitch
+}
+
+// sumGlitches gives the probability of a glitch from the distribution of 1s.
+func sumGlitches(ones []float64, pool int, glitchy int) float64 {
+	glitch := 0.0
+	for count, p := range ones {
+		if (count+glitchy)*2 > pool {
+			glitch += p
+		}
+	}
+	return glitch
+}
+
+// criticalGlitch is the probability of a glitch with no hits. With no hits
+// there are no sixes, so the Rule of Six doesn't change it.
+func criticalGlitch(pool int, glitchy int, secondChance bool) float64 {
+	pMiss, pOne := 1.0/2, 1.0/6
+	if secondChance {
+		pMiss, pOne = 3.0/9, 1.0/9
+	}
+	// Not a distribution: each entry is P(no hits and exactly that many 1s).
+	ones := convolvePool([]float64{pMiss, pOne}, pool)
+	return sumGlitches(ones, pool, glitchy)
+}
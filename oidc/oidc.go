@@ -0,0 +1,331 @@
+// Package oidc implements the parts of OpenID Connect's authorization code
+// flow with PKCE that Shadowroller uses to log players in with an external
+// identity provider.
+//
+// The provider is configured with `config.OIDCIssuer`. Plain HTTP issuers are
+// allowed so a local stand-in provider can be used in development.
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"sr/config"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrDisabled means no OIDC provider is configured.
+var ErrDisabled = errors.New("oidc is disabled")
+
+// ErrInvalidToken means the provider's ID token could not be verified.
+var ErrInvalidToken = errors.New("invalid id token")
+
+// Identity is a verified identity from the provider's ID token.
+type Identity struct {
+	Issuer  string
+	Subject string
+	Name    string
+	Nonce   string
+}
+
+// Key identifies the identity across providers.
+func (i *Identity) Key() string {
+	return i.Issuer + " " + i.Subject
+}
+
+// Enabled determines if an OIDC provider is configured.
+func Enabled() bool {
+	return config.OIDCIssuer != "" && config.OIDCClientID != ""
+}
+
+type provider struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+
+	keys map[string]*rsa.PublicKey
+}
+
+var client = &http.Client{Timeout: 10 * time.Second}
+
+var providerLock sync.Mutex
+var cachedProvider *provider
+
+// getProvider fetches the provider's discovery document, once.
+func getProvider(ctx context.Context) (*provider, error) {
+	if !Enabled() {
+		return nil, ErrDisabled
+	}
+	providerLock.Lock()
+	defer providerLock.Unlock()
+	if cachedProvider != nil {
+		return cachedProvider, nil
+	}
+	var found provider
+	discoveryURL := strings.TrimSuffix(config.OIDCIssuer, "/") + "/.well-known/openid-configuration"
+	if err := getJSON(ctx, discoveryURL, &found); err != nil {
+		return nil, fmt.Errorf("fetching oidc discovery: %w", err)
+	}
+	if found.Issuer != config.OIDCIssuer {
+		return nil, fmt.Errorf("oidc discovery issuer %v does not match %v", found.Issuer, config.OIDCIssuer)
+	}
+	cachedProvider = &found
+	return cachedProvider, nil
+}
+
+// getKey finds the provider's signing key with the given ID, refetching the
+// provider's keys if it is not known.
+func getKey(ctx context.Context, prov *provider, keyID string) (*rsa.PublicKey, error) {
+	providerLock.Lock()
+	defer providerLock.Unlock()
+	if key, ok := prov.keys[keyID]; ok {
+		return key, nil
+	}
+	var jwks struct {
+		Keys []struct {
+			KeyID   string `json:"kid"`
+			KeyType string `json:"kty"`
+			N       string `json:"n"`
+			E       string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := getJSON(ctx, prov.JWKSURI, &jwks); err != nil {
+		return nil, fmt.Errorf("fetching oidc keys: %w", err)
+	}
+	keys := make(map[string]*rsa.PublicKey, len(jwks.Keys))
+	for _, jwk := range jwks.Keys {
+		if jwk.KeyType != "RSA" {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			return nil, fmt.Errorf("decoding oidc key %v: %w", jwk.KeyID, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			return nil, fmt.Errorf("decoding oidc key %v: %w", jwk.KeyID, err)
+		}
+		keys[jwk.KeyID] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	prov.keys = keys
+	key, ok := keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown key %v", ErrInvalidToken, keyID)
+	}
+	return key, nil
+}
+
+// NewVerifier creates a random PKCE code verifier and its S256 challenge.
+func NewVerifier() (string, string) {
+	verifier := RandomString()
+	sum := sha256.Sum256([]byte(verifier))
+	return verifier, base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// RandomString creates a random URL-safe string for states, nonces and
+// verifiers.
+func RandomString() string {
+	bytes := make([]byte, 32)
+	rand.Read(bytes)
+	return base64.RawURLEncoding.EncodeToString(bytes)
+}
+
+// AuthURL builds the provider URL players are sent to in order to log in.
+func AuthURL(ctx context.Context, state string, nonce string, challenge string) (string, error) {
+	prov, err := getProvider(ctx)
+	if err != nil {
+		return "", err
+	}
+	authURL, err := url.Parse(prov.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("parsing oidc authorization endpoint: %w", err)
+	}
+	query := authURL.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", config.OIDCClientID)
+	query.Set("redirect_uri", config.OIDCRedirectURL)
+	query.Set("scope", config.OIDCScopes)
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", challenge)
+	query.Set("code_challenge_method", "S256")
+	authURL.RawQuery = query.Encode()
+	return authURL.String(), nil
+}
+
+// Exchange trades an authorization code and its PKCE verifier for the
+// provider's ID token, and verifies it. The caller must check the nonce.
+func Exchange(ctx context.Context, code string, verifier string) (*Identity, error) {
+	prov, err := getProvider(ctx)
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", config.OIDCRedirectURL)
+	form.Set("client_id", config.OIDCClientID)
+	form.Set("code_verifier", verifier)
+	if config.OIDCClientSecret != "" {
+		form.Set("client_secret", config.OIDCClientSecret)
+	}
+	request, err := http.NewRequestWithContext(
+		ctx, "POST", prov.TokenEndpoint, strings.NewReader(form.Encode()),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("creating oidc token request: %w", err)
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+	var tokens struct {
+		IDToken string `json:"id_token"`
+	}
+	if err = doJSON(request, &tokens); err != nil {
+		return nil, fmt.Errorf("exchanging oidc code: %w", err)
+	}
+	if tokens.IDToken == "" {
+		return nil, fmt.Errorf("%w: no id_token in response", ErrInvalidToken)
+	}
+	return verifyIDToken(ctx, prov, tokens.IDToken)
+}
+
+// verifyIDToken checks the signature, issuer, audience and expiry of an RS256
+// ID token, and returns its identity.
+func verifyIDToken(ctx context.Context, prov *provider, token string) (*Identity, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed", ErrInvalidToken)
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+	if header.Alg != "RS256" {
+		return nil, fmt.Errorf("%w: unsupported alg %v", ErrInvalidToken, header.Alg)
+	}
+	key, err := getKey(ctx, prov, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: decoding signature: %v", ErrInvalidToken, err)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	var claims struct {
+		Issuer            string          `json:"iss"`
+		Subject           string          `json:"sub"`
+		Audience          json.RawMessage `json:"aud"`
+		Expires           int64           `json:"exp"`
+		Nonce             string          `json:"nonce"`
+		Name              string          `json:"name"`
+		PreferredUsername string          `json:"preferred_username"`
+	}
+	if err = decodeSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	if claims.Issuer != prov.Issuer {
+		return nil, fmt.Errorf("%w: issuer %v", ErrInvalidToken, claims.Issuer)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: no subject", ErrInvalidToken)
+	}
+	if !hasAudience(claims.Audience, config.OIDCClientID) {
+		return nil, fmt.Errorf("%w: audience %s", ErrInvalidToken, claims.Audience)
+	}
+	// Allow a minute of clock skew
+	if time.Now().Add(-time.Minute).Unix() > claims.Expires {
+		return nil, fmt.Errorf("%w: expired at %v", ErrInvalidToken, claims.Expires)
+	}
+	name := claims.Name
+	if name == "" {
+		name = claims.PreferredUsername
+	}
+	return &Identity{
+		Issuer:  claims.Issuer,
+		Subject: claims.Subject,
+		Name:    name,
+		Nonce:   claims.Nonce,
+	}, nil
+}
+
+// hasAudience checks an `aud` claim, which may be a string or a list.
+func hasAudience(audience json.RawMessage, clientID string) bool {
+	var single string
+	if err := json.Unmarshal(audience, &single); err == nil {
+		return single == clientID
+	}
+	var list []string
+	if err := json.Unmarshal(audience, &list); err != nil {
+		return false
+	}
+	for _, aud := range list {
+		if aud == clientID {
+			return true
+		}
+	}
+	return false
+}
+
+func decodeSegment(segment string, value interface{}) error {
+	decoded, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return fmt.Errorf("%w: decoding segment: %v", ErrInvalidToken, err)
+	}
+	if err = json.Unmarshal(decoded, value); err != nil {
+		return fmt.Errorf("%w: parsing segment: %v", ErrInvalidToken, err)
+	}
+	return nil
+}
+
+func getJSON(ctx context.Context, url string, value interface{}) error {
+	request, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return fmt.Errorf("creating request to %v: %w", url, err)
+	}
+	request.Header.Set("Accept", "application/json")
+	return doJSON(request, value)
+}
+
+func doJSON(request *http.Request, value interface{}) error {
+	response, err := client.Do(request)
+	if err != nil {
+		return fmt.Errorf("requesting %v: %w", request.URL, err)
+	}
+	defer response.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(response.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("reading %v: %w", request.URL, err)
+	}
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("%v responded %v: %s", request.URL, response.Status, body)
+	}
+	if err = json.Unmarshal(body, value); err != nil {
+		return fmt.Errorf("parsing %v: %w", request.URL, err)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package player
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gomodule/redigo/redis"
+	"golang.org/x/crypto/bcrypt"
+	"sr/config"
+	"sr/id"
+)
+
+// ErrWrongPassphrase means a passphrase did not match the player's.
+var ErrWrongPassphrase = errors.New("wrong passphrase")
+
+// MaxPassphraseLength is the longest passphrase bcrypt can hash, in bytes.
+const MaxPassphraseLength = 72
+
+// ValidPassphrase determines if a passphrase is long enough to set, and not
+// too long to hash.
+func ValidPassphrase(passphrase string) bool {
+	return len([]rune(passphrase)) >= config.MinPassphraseLength &&
+		len(passphrase) <= MaxPassphraseLength
+}
+
+// HasPassphrase determines if a player has set a passphrase.
+func HasPassphrase(playerID id.UID, conn redis.Conn) (bool, error) {
+	has, err := redis.Bool(conn.Do("HEXISTS", "player:"+string(playerID), "passphrase"))
+	if err != nil {
+		return false, fmt.Errorf("redis error checking passphrase of %v: %w", playerID, err)
+	}
+	return has, nil
+}
+
+// CheckPassphrase checks a passphrase against the player's. Players without a
+// passphrase accept any passphrase. Returns ErrWrongPassphrase if it does not
+// match.
+func CheckPassphrase(playerID id.UID, passphrase string, conn redis.Conn) error {
+	hash, err := redis.Bytes(conn.Do("HGET", "player:"+string(playerID), "passphrase"))
+	if errors.Is(err, redis.ErrNil) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("redis error getting passphrase of %v: %w", playerID, err)
+	}
+	err = bcrypt.CompareHashAndPassword(hash, []byte(passphrase))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return fmt.Errorf("%w for %v", ErrWrongPassphrase, playerID)
+	} else if err != nil {
+		return fmt.Errorf("comparing passphrase of %v: %w", playerID, err)
+	}
+	return nil
+}
+
+// SetPassphrase hashes and sets a player's passphrase.
+func SetPassphrase(playerID id.UID, passphrase string, conn redis.Conn) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(passphrase), config.PassphraseHashCost)
+	if err != nil {
+		return fmt.Errorf("hashing passphrase of %v: %w", playerID, err)
+	}
+	if _, err = conn.Do("HSET", "player:"+string(playerID), "passphrase", hash); err != nil {
+		return fmt.Errorf("redis error setting passphrase of %v: %w", playerID, err)
+	}
+	return nil
+}
+
+// RemovePassphrase removes a player's passphrase, so they log in without one.
+func RemovePassphrase(playerID id.UID, conn redis.Conn) error {
+	if _, err := conn.Do("HDEL", "player:"+string(playerID), "passphrase"); err != nil {
+		return fmt.Errorf("redis error removing passphrase of %v: %w", playerID, err)
+	}
+	return nil
+}
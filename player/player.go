@@ -6,8 +6,10 @@ import (
 	"fmt"
 	"log"
 	"math/rand"
+	"sr/config"
 	"sr/id"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/gomodule/redigo/redis"
 )
@@ -15,6 +17,9 @@ import (
 // ErrNotFound means a player was not found.
 var ErrNotFound = errors.New("player not found")
 
+// ErrUsernameTaken means a new player's username belongs to another player.
+var ErrUsernameTaken = errors.New("username taken")
+
 // OnlineMode is a toggle for show as online/show as offline
 type OnlineMode = int
 
@@ -27,6 +32,9 @@ var OnlineModeOnline OnlineMode = 1
 // OnlineModeOffline indicates a player will always be shown as offline
 var OnlineModeOffline OnlineMode = 2
 
+// OnlineModeAway indicates a player will be shown as online and away when connected to a game
+var OnlineModeAway OnlineMode = 3
+
 // Player is a user of Shadowroller.
 //
 // Players may be registered for a number of games.
@@ -36,18 +44,31 @@ type Player struct {
 	Name string `redis:"name"`
 	Hue  int    `redis:"hue"`
 
-	Username    string     `redis:"uname"`
-	Connections int        `redis:"connections"`
-	OnlineMode  OnlineMode `redis:"onlineMode"`
+	Username   string     `redis:"uname"`
+	OnlineMode OnlineMode `redis:"onlineMode"`
+	Status     string     `redis:"status"`
+
+	// Connected is whether the player is connected to the game they were
+	// loaded for. It's set by the game, not stored with the player.
+	Connected bool `redis:"-"`
+	// Idle is whether the player has been inactive in the game they were
+	// loaded for. It's set by the game, not stored with the player.
+	Idle bool `redis:"-"`
+	// Activity is what the player is doing in the game they were loaded for,
+	// such as typing. It's set by the game, not stored with the player.
+	Activity string `redis:"-"`
 }
 
 // Info is data other players can see about a player.
 // - `username` is not shown.
 type Info struct {
-	ID     id.UID `json:"id"`
-	Name   string `json:"name"`
-	Hue    int    `json:"hue"`
-	Online bool   `json:"online"`
+	ID       id.UID `json:"id"`
+	Name     string `json:"name"`
+	Hue      int    `json:"hue"`
+	Online   bool   `json:"online"`
+	Away     bool   `json:"away"`
+	Status   string `json:"status,omitempty"`
+	Activity string `json:"activity,omitempty"`
 }
 
 func (p *Player) String() string {
@@ -56,33 +77,41 @@ func (p *Player) String() string {
 	)
 }
 
-// MarshalJSON writes a player to JSON. It secifies `online` instead of connections.
+// MarshalJSON writes a player to JSON. It secifies `online` instead of whether the player is connected.
 func (p *Player) MarshalJSON() ([]byte, error) {
-	fields := make(map[string]interface{}, 5)
+	fields := make(map[string]interface{}, 7)
 	fields["id"] = p.ID
 	fields["name"] = p.Name
 	fields["hue"] = p.Hue
 	fields["username"] = p.Username
 	fields["online"] = p.IsOnline()
 	fields["onlineMode"] = p.OnlineMode
+	fields["status"] = p.Status
 	return json.Marshal(fields)
 }
 
 // Info returns game-readable information about the player
 func (p *Player) Info() Info {
-	return Info{
+	online := p.IsOnline()
+	info := Info{
 		ID:     p.ID,
 		Name:   p.Name,
 		Hue:    p.Hue,
-		Online: p.IsOnline(),
+		Online: online,
+		Away:   p.IsAway(),
+		Status: p.Status,
+	}
+	if online {
+		info.Activity = p.Activity
 	}
+	return info
 }
 
 // IsOnline indicates if a player is actively connected, or has chosen to be seen as such.
 func (p *Player) IsOnline() bool {
 	switch p.OnlineMode {
-	case OnlineModeAuto:
-		return p.Connections > 0
+	case OnlineModeAuto, OnlineModeAway:
+		return p.Connected
 	case OnlineModeOnline:
 		return true
 	case OnlineModeOffline:
@@ -93,6 +122,14 @@ func (p *Player) IsOnline() bool {
 	}
 }
 
+// IsAway indicates if a player is online but idle, or has chosen to be seen as away.
+func (p *Player) IsAway() bool {
+	if !p.IsOnline() {
+		return false
+	}
+	return p.Idle || p.OnlineMode == OnlineModeAway
+}
+
 // RedisKey is the key for acccessing player info from redis
 func (p *Player) RedisKey() string {
 	if p == nil || p.ID == "" {
@@ -104,12 +141,11 @@ func (p *Player) RedisKey() string {
 // Make constructs a new Player object, giving it a UID
 func Make(username string, name string) Player {
 	return Player{
-		ID:          id.GenUID(),
-		Username:    username,
-		Name:        name,
-		Hue:         RandomHue(),
-		Connections: 0,
-		OnlineMode:  OnlineModeAuto,
+		ID:         id.GenUID(),
+		Username:   username,
+		Name:       name,
+		Hue:        RandomHue(),
+		OnlineMode: OnlineModeAuto,
 	}
 }
 
@@ -215,6 +251,12 @@ func GetByUsername(username string, conn redis.Conn) (*Player, error) {
 	return GetByID(playerID, conn)
 }
 
+// ValidStatus determines if a player status is valid.
+// It checks for 0-64 chars with no newlines.
+func ValidStatus(status string) bool {
+	return utf8.RuneCountInString(status) <= 64 && !strings.ContainsAny(status, "\r\n")
+}
+
 // RandomHue creates a random hue value for a player
 func RandomHue() int {
 	return rand.Intn(360)
@@ -283,45 +325,63 @@ func GetPlayerChars(playerID UID, conn redis.Conn) ([]Char, error) {
 }
 */
 
-// Create adds the given Player to the database
+// Create adds the given Player to the database. The username is checked
+// under a watch, so it returns ErrUsernameTaken if another player claimed it
+// first instead of replacing their username's mapping.
 func Create(player *Player, conn redis.Conn) error {
-	err := conn.Send("MULTI")
-	if err != nil {
-		return fmt.Errorf("redis error sending `MULTI`: %w", err)
-	}
-
-	err = conn.Send("HSET", "player_ids", player.Username, player.ID)
-	if err != nil {
-		return fmt.Errorf("redis error sending `player_ids` `HSET`: %w", err)
-	}
-
-	playerData := redis.Args{}.Add(player.RedisKey()).AddFlat(player)
-	err = conn.Send("HSET", playerData...)
-	if err != nil {
-		return fmt.Errorf("redis error sending `player:id` `HSET`: %w", err)
-	}
+	tryCreate := func() error {
+		if _, err := conn.Do("WATCH", "player_ids"); err != nil {
+			return fmt.Errorf("redis error sending `WATCH`: %w", err)
+		}
+		taken, err := redis.Bool(conn.Do("HEXISTS", "player_ids", player.Username))
+		if err == nil && taken {
+			err = fmt.Errorf("%w: %v", ErrUsernameTaken, player.Username)
+		} else if err != nil {
+			err = fmt.Errorf("redis error checking username %v: %w", player.Username, err)
+		}
+		if err != nil {
+			if _, unwatchErr := conn.Do("UNWATCH"); unwatchErr != nil {
+				return fmt.Errorf("redis error sending `UNWATCH`: %w", unwatchErr)
+			}
+			return err
+		}
 
-	data, err := redis.Ints(conn.Do("Exec"))
-	if err != nil {
-		return fmt.Errorf("redis error sending `EXEC`: %w", err)
-	}
+		// MULTI: claim username, set player data, or nil if aborted
+		err = conn.Send("MULTI")
+		if err != nil {
+			return fmt.Errorf("redis error sending `MULTI`: %w", err)
+		}
 
-	// expected 1 update for player_ids, n updates for player fields
-	if len(data) != 2 || data[0] != 1 || data[1] <= 2 {
-		return fmt.Errorf("redis error with multi: expected [1, >1], got %v", data)
-	}
-	return nil
-}
+		err = conn.Send("HSET", "player_ids", player.Username, player.ID)
+		if err != nil {
+			return fmt.Errorf("redis error sending `player_ids` `HSET`: %w", err)
+		}
 
-// IncreaseConnections is used when a new connection is established
-const IncreaseConnections = +1
+		playerData := redis.Args{}.Add(player.RedisKey()).AddFlat(player)
+		err = conn.Send("HSET", playerData...)
+		if err != nil {
+			return fmt.Errorf("redis error sending `player:id` `HSET`: %w", err)
+		}
 
-// DecreaseConnections is used when a connection is closed
-const DecreaseConnections = -1
+		data, err := redis.Ints(conn.Do("Exec"))
+		if errors.Is(err, redis.ErrNil) {
+			return errTransactionAborted
+		} else if err != nil {
+			return fmt.Errorf("redis error sending `EXEC`: %w", err)
+		}
 
-// ModifyConnections modifies the Connections attribute of a player; used by the subscription handler
-func ModifyConnections(playerID id.UID, amount int, conn redis.Conn) (int, error) {
-	return redis.Int(conn.Do(
-		"HINCRBY", "player:"+playerID, "connections", amount,
-	))
+		// expected 1 update for player_ids, n updates for player fields
+		if len(data) != 2 || data[0] != 1 || data[1] <= 2 {
+			return fmt.Errorf("redis error with multi: expected [1, >1], got %v", data)
+		}
+		return nil
+	}
+	var err error
+	for i := 0; i < config.RedisRetries; i++ {
+		err = tryCreate()
+		if !errors.Is(err, errTransactionAborted) {
+			return err
+		}
+	}
+	return fmt.Errorf("after max attempts: %w", err)
 }
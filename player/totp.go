@@ -0,0 +1,272 @@
+package player
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/gomodule/redigo/redis"
+	"net/url"
+	"sr/config"
+	"sr/id"
+	"strings"
+	"time"
+)
+
+// ErrWrongCode means a TOTP or recovery code did not match the player's.
+var ErrWrongCode = errors.New("wrong code")
+
+// ErrTOTPNotEnrolling means a player confirmed TOTP without starting to enroll.
+var ErrTOTPNotEnrolling = errors.New("totp enrollment not started")
+
+// totpStep is the time step of TOTP codes, per RFC 6238.
+const totpStep = 30
+
+// totpDigits is the number of digits in a TOTP code.
+const totpDigits = 6
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+func recoveryCodesKey(playerID id.UID) string {
+	return "recovery-codes:" + string(playerID)
+}
+
+// TOTPURI creates the `otpauth://` provisioning URI for a TOTP secret, which
+// authenticator apps read from a QR code.
+func TOTPURI(secret string, username string) string {
+	label := url.PathEscape(config.TOTPIssuer + ":" + username)
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", config.TOTPIssuer)
+	query.Set("digits", fmt.Sprintf("%v", totpDigits))
+	query.Set("period", fmt.Sprintf("%v", totpStep))
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
+
+// totpCode computes the code for a secret at a time step, per RFC 4226.
+func totpCode(key []byte, step int64) string {
+	message := make([]byte, 8)
+	binary.BigEndian.PutUint64(message, uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(message)
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0xf
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%06d", value%1000000)
+}
+
+// matchTOTP finds the time step a code is valid for, allowing one step of
+// clock drift either way. It returns 0 if the code does not match.
+func matchTOTP(secret string, code string, now time.Time) int64 {
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil || len(code) != totpDigits {
+		return 0
+	}
+	current := now.Unix() / totpStep
+	for step := current - 1; step <= current+1; step++ {
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, step)), []byte(code)) == 1 {
+			return step
+		}
+	}
+	return 0
+}
+
+// HasTOTP determines if a player has enabled TOTP two-factor authentication.
+func HasTOTP(playerID id.UID, conn redis.Conn) (bool, error) {
+	enabled, err := redis.Bool(conn.Do("HGET", "player:"+string(playerID), "totpEnabled"))
+	if errors.Is(err, redis.ErrNil) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("redis error checking totp of %v: %w", playerID, err)
+	}
+	return enabled, nil
+}
+
+// CountRecoveryCodes counts a player's unused recovery codes.
+func CountRecoveryCodes(playerID id.UID, conn redis.Conn) (int, error) {
+	count, err := redis.Int(conn.Do("SCARD", recoveryCodesKey(playerID)))
+	if err != nil {
+		return 0, fmt.Errorf("redis error counting recovery codes of %v: %w", playerID, err)
+	}
+	return count, nil
+}
+
+// StartTOTPEnrollment creates a new TOTP secret for a player. It is not used
+// to log in until the player confirms it with a code.
+func StartTOTPEnrollment(playerID id.UID, conn redis.Conn) (string, error) {
+	key := make([]byte, 20)
+	if _, err := rand.Read(key); err != nil {
+		return "", fmt.Errorf("generating totp secret: %w", err)
+	}
+	secret := totpEncoding.EncodeToString(key)
+	if _, err := conn.Do("HSET", "player:"+string(playerID), "totpPending", secret); err != nil {
+		return "", fmt.Errorf("redis error setting pending totp of %v: %w", playerID, err)
+	}
+	return secret, nil
+}
+
+// ConfirmTOTP enables the TOTP secret a player is enrolling if the code
+// matches it, replacing any previous secret, and returns new recovery codes.
+func ConfirmTOTP(playerID id.UID, code string, conn redis.Conn) ([]string, error) {
+	secret, err := redis.String(conn.Do("HGET", "player:"+string(playerID), "totpPending"))
+	if errors.Is(err, redis.ErrNil) {
+		return nil, fmt.Errorf("%w for %v", ErrTOTPNotEnrolling, playerID)
+	} else if err != nil {
+		return nil, fmt.Errorf("redis error getting pending totp of %v: %w", playerID, err)
+	}
+	step := matchTOTP(secret, code, time.Now())
+	if step == 0 {
+		return nil, fmt.Errorf("%w for %v", ErrWrongCode, playerID)
+	}
+
+	// MULTI: enable secret, remove pending secret
+	if err = conn.Send("MULTI"); err != nil {
+		return nil, fmt.Errorf("redis error sending `MULTI`: %w", err)
+	}
+	if err = conn.Send("HSET", "player:"+string(playerID),
+		"totpSecret", secret, "totpStep", step, "totpEnabled", true,
+	); err != nil {
+		return nil, fmt.Errorf("redis error sending `HSET` totp: %w", err)
+	}
+	if err = conn.Send("HDEL", "player:"+string(playerID), "totpPending"); err != nil {
+		return nil, fmt.Errorf("redis error sending `HDEL` pending totp: %w", err)
+	}
+	if _, err = conn.Do("EXEC"); err != nil {
+		return nil, fmt.Errorf("redis error sending `EXEC`: %w", err)
+	}
+	return GenerateRecoveryCodes(playerID, conn)
+}
+
+// DisableTOTP turns off TOTP for a player and removes their recovery codes.
+func DisableTOTP(playerID id.UID, conn redis.Conn) error {
+	// MULTI: remove secret, remove recovery codes
+	if err := conn.Send("MULTI"); err != nil {
+		return fmt.Errorf("redis error sending `MULTI`: %w", err)
+	}
+	if err := conn.Send("HDEL", "player:"+string(playerID),
+		"totpSecret", "totpStep", "totpEnabled", "totpPending",
+	); err != nil {
+		return fmt.Errorf("redis error sending `HDEL` totp: %w", err)
+	}
+	if err := conn.Send("DEL", recoveryCodesKey(playerID)); err != nil {
+		return fmt.Errorf("redis error sending `DEL` recovery codes: %w", err)
+	}
+	if _, err := conn.Do("EXEC"); err != nil {
+		return fmt.Errorf("redis error sending `EXEC`: %w", err)
+	}
+	return nil
+}
+
+// GenerateRecoveryCodes replaces a player's recovery codes with new ones,
+// which are returned. Only their hashes are stored.
+func GenerateRecoveryCodes(playerID id.UID, conn redis.Conn) ([]string, error) {
+	codes := make([]string, config.RecoveryCodeCount)
+	hashes := make([]string, config.RecoveryCodeCount)
+	for i := range codes {
+		bytes := make([]byte, 5)
+		if _, err := rand.Read(bytes); err != nil {
+			return nil, fmt.Errorf("generating recovery code: %w", err)
+		}
+		codes[i] = strings.ToLower(totpEncoding.EncodeToString(bytes))
+		hashes[i] = hashRecoveryCode(codes[i])
+	}
+
+	// MULTI: replace recovery codes
+	if err := conn.Send("MULTI"); err != nil {
+		return nil, fmt.Errorf("redis error sending `MULTI`: %w", err)
+	}
+	if err := conn.Send("DEL", recoveryCodesKey(playerID)); err != nil {
+		return nil, fmt.Errorf("redis error sending `DEL` recovery codes: %w", err)
+	}
+	if err := conn.Send("SADD", redis.Args{}.Add(recoveryCodesKey(playerID)).AddFlat(hashes)...); err != nil {
+		return nil, fmt.Errorf("redis error sending `SADD` recovery codes: %w", err)
+	}
+	if _, err := conn.Do("EXEC"); err != nil {
+		return nil, fmt.Errorf("redis error sending `EXEC`: %w", err)
+	}
+	return codes, nil
+}
+
+func hashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(code))))
+	return hex.EncodeToString(sum[:])
+}
+
+// CheckSecondFactor checks a TOTP code, or uses up a recovery code, for a
+// player with TOTP enabled. A TOTP code can't be reused. Returns ErrWrongCode
+// if neither matches.
+func CheckSecondFactor(playerID id.UID, code string, conn redis.Conn) error {
+	code = strings.TrimSpace(code)
+	var err error
+	for i := 0; i < config.RedisRetries; i++ {
+		var matched bool
+		matched, err = useTOTP(playerID, code, conn)
+		if matched {
+			return nil
+		}
+		if errors.Is(err, errTransactionAborted) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		removed, err := redis.Int(conn.Do("SREM", recoveryCodesKey(playerID), hashRecoveryCode(code)))
+		if err != nil {
+			return fmt.Errorf("redis error using recovery code of %v: %w", playerID, err)
+		}
+		if removed != 1 {
+			return fmt.Errorf("%w for %v", ErrWrongCode, playerID)
+		}
+		return nil
+	}
+	return fmt.Errorf("after max attempts: %w", err)
+}
+
+// errTransactionAborted means a watched key changed during a transaction.
+var errTransactionAborted = errors.New("transaction aborted")
+
+// useTOTP records a TOTP code's time step as used if it matches the player's
+// secret and is later than the last step used. The step is watched so two
+// logins can't both use the same code.
+func useTOTP(playerID id.UID, code string, conn redis.Conn) (bool, error) {
+	if _, err := conn.Do("WATCH", "player:"+string(playerID)); err != nil {
+		return false, fmt.Errorf("redis error sending `WATCH`: %w", err)
+	}
+	values, err := redis.Values(conn.Do("HMGET", "player:"+string(playerID), "totpSecret", "totpStep"))
+	if err != nil {
+		return false, fmt.Errorf("redis error getting totp of %v: %w", playerID, err)
+	}
+	var secret string
+	var lastStep int64
+	if _, err = redis.Scan(values, &secret, &lastStep); err != nil {
+		return false, fmt.Errorf("redis error parsing totp of %v: %w", playerID, err)
+	}
+	step := matchTOTP(secret, code, time.Now())
+	if step <= lastStep {
+		if _, err = conn.Do("UNWATCH"); err != nil {
+			return false, fmt.Errorf("redis error sending `UNWATCH`: %w", err)
+		}
+		return false, nil
+	}
+
+	// MULTI: set last step used, or nil if aborted
+	if err = conn.Send("MULTI"); err != nil {
+		return false, fmt.Errorf("redis error sending `MULTI`: %w", err)
+	}
+	if err = conn.Send("HSET", "player:"+string(playerID), "totpStep", step); err != nil {
+		return false, fmt.Errorf("redis error sending `HSET` totp step: %w", err)
+	}
+	_, err = redis.Ints(conn.Do("EXEC"))
+	if errors.Is(err, redis.ErrNil) {
+		return false, errTransactionAborted
+	} else if err != nil {
+		return false, fmt.Errorf("redis error sending `EXEC`: %w", err)
+	}
+	return true, nil
+}
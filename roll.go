@@ -97,6 +97,51 @@ func RerollFailures(original []int) []int {
 
 }
 
+// CountHits counts the hits (5s and 6s) in a roll.
+func CountHits(dice []int) int {
+	hits := 0
+	for _, die := range dice {
+		if die == 5 || die == 6 {
+			hits++
+		}
+	}
+	return hits
+}
+
+// CountOnes counts the 1s in a roll.
+func CountOnes(dice []int) int {
+	ones := 0
+	for _, die := range dice {
+		if die == 1 {
+			ones++
+		}
+	}
+	return ones
+}
+
+// IsGlitched determines if a roll glitches: more than half of the dice came
+// up 1s. Each point of glitchy counts as an extra 1.
+func IsGlitched(dice []int, glitchy int) bool {
+	if len(dice) == 0 {
+		return false
+	}
+	return (CountOnes(dice)+glitchy)*2 > len(dice)
+}
+
+// IsCriticalGlitch determines if a roll glitches with no hits.
+func IsCriticalGlitch(dice []int, glitchy int) bool {
+	return IsGlitched(dice, glitchy) && CountHits(dice) == 0
+}
+
+// FlattenRounds combines the rounds of an edge roll into one list of dice.
+func FlattenRounds(rounds [][]int) []int {
+	var dice []int
+	for _, round := range rounds {
+		dice = append(dice, round...)
+	}
+	return dice
+}
+
 // SumRolls is Array[int].Sum
 func SumRolls(roll []int) int {
 	result := 0
@@ -162,13 +207,16 @@ func GenerateRolls() {
 			// Read will either read to full or report an error.
 			if err != nil {
 				log.Printf("Error calling roll RNG: %v", err)
+				monitor.recordReadError()
 				time.Sleep(time.Duration(50) * time.Millisecond)
 				continue
 			}
 			for _, randByte := range bytes {
 				if randByte <= inputByteMax {
 					// convert 0 .. 5 (result of % 6) to 1 .. 6
-					rollsChan <- int((randByte % rollMax) + 1)
+					die := int((randByte % rollMax) + 1)
+					monitor.recordDie(die)
+					rollsChan <- die
 				}
 				// Just skip bytes between inputByteMax and 255 (2% of bytes)
 			}
@@ -6,6 +6,8 @@ import (
 	"sr/game"
 	"sr/player"
 	"sr/session"
+
+	"github.com/gomodule/redigo/redis"
 )
 
 var authRouter = restRouter.PathPrefix("/auth").Subrouter()
@@ -16,15 +18,55 @@ type loginResponse struct {
 	Session  string         `json:"session"`
 }
 
+type secondFactorResponse struct {
+	SecondFactor bool   `json:"secondFactor"`
+	Challenge    string `json:"challenge"`
+}
+
+// requireSecondFactor responds with a challenge and returns true if the player
+// must give a second factor before getting a session. Invites given are
+// redeemed once the second factor is given.
+func requireSecondFactor(response Response, request *Request, plr *player.Player, gameID string, invite string, persist bool, conn redis.Conn) bool {
+	needed, err := auth.NeedsSecondFactor(plr, conn)
+	httpInternalErrorIf(response, request, err)
+	if !needed {
+		return false
+	}
+	challenge, err := auth.BeginSecondFactor(plr, gameID, invite, persist, conn)
+	httpInternalErrorIf(response, request, err)
+	err = writeBodyJSON(response, secondFactorResponse{
+		SecondFactor: true,
+		Challenge:    challenge,
+	})
+	httpInternalErrorIf(response, request, err)
+	httpSuccess(response, request, "Second factor needed for ", plr.ID, " in ", gameID)
+	return true
+}
+
+// requestCurrentPlayer retrieves the player of the request's session, or nil if
+// the request has no session.
+func requestCurrentPlayer(response Response, request *Request) *player.Player {
+	if _, err := sessionFromHeader(request); err != nil {
+		return nil
+	}
+	sess, conn, err := requestSession(request)
+	httpUnauthorizedIf(response, request, err)
+	requirePlayerSession(response, request, sess)
+	plr, err := sess.GetPlayer(conn)
+	httpInternalErrorIf(response, request, err)
+	return plr
+}
+
 // POST /auth/login { gameID, playerName } -> auth token, session token
 var _ = authRouter.HandleFunc("/login", handleLogin).Methods("POST")
 
 func handleLogin(response Response, request *Request) {
 	logRequest(request)
 	var login struct {
-		GameID   string `json:"gameID"`
-		Username string `json:"username"`
-		Persist  bool   `json:"persist"`
+		GameID     string `json:"gameID"`
+		Username   string `json:"username"`
+		Passphrase string `json:"passphrase"`
+		Persist    bool   `json:"persist"`
 	}
 	err := readBodyJSON(request, &login)
 	httpBadRequestIf(response, request, err)
@@ -39,11 +81,13 @@ func handleLogin(response Response, request *Request) {
 	)
 
 	conn := contextRedisConn(request.Context())
-	gameInfo, plr, err := auth.LogPlayerIn(login.GameID, login.Username, conn)
+	gameInfo, plr, err := auth.LogPlayerIn(login.GameID, login.Username, login.Passphrase, conn)
 	if err != nil {
 		logf(request, "Login response: %v", err)
 	}
-	if errors.Is(err, player.ErrNotFound) ||
+	if errors.Is(err, auth.ErrTooManyAttempts) {
+		httpTooManyRequests(response, request, "Too many login attempts, try again later")
+	} else if errors.Is(err, player.ErrNotFound) ||
 		errors.Is(err, game.ErrNotFound) ||
 		errors.Is(err, auth.ErrNotAuthorized) {
 		httpForbiddenIf(response, request, err)
@@ -52,9 +96,12 @@ func handleLogin(response Response, request *Request) {
 		httpInternalErrorIf(response, request, err)
 	}
 	logf(request, "Found %v in %v", plr.ID, login.GameID)
+	if requireSecondFactor(response, request, plr, login.GameID, "", login.Persist, conn) {
+		return
+	}
 
 	logf(request, "Creating session %s for %v", status, plr.ID)
-	session, err := session.New(login.GameID, plr, login.Persist, conn)
+	session, err := session.New(login.GameID, plr, login.Persist, requestUserAgent(request), conn)
 	httpInternalErrorIf(response, request, err)
 	logf(request, "Created session %v for %v", session.ID, plr.ID)
 	logf(request, "Got game info %v", gameInfo)
@@ -71,6 +118,120 @@ func handleLogin(response Response, request *Request) {
 	)
 }
 
+// POST /auth/join { code, username, name, passphrase, persist } -> { login response }
+// Logged in players join as themselves with their session.
+var _ = authRouter.HandleFunc("/join", handleJoin).Methods("POST")
+
+func handleJoin(response Response, request *Request) {
+	logRequest(request)
+	var join struct {
+		Code       string `json:"code"`
+		Username   string `json:"username"`
+		Name       string `json:"name"`
+		Passphrase string `json:"passphrase"`
+		Persist    bool   `json:"persist"`
+	}
+	err := readBodyJSON(request, &join)
+	httpBadRequestIf(response, request, err)
+	logf(request, "Join request: %v with invite %v", join.Username, join.Code)
+
+	conn := contextRedisConn(request.Context())
+	current := requestCurrentPlayer(response, request)
+	joining, err := auth.CheckJoin(join.Code, join.Username, join.Name, join.Passphrase, current, conn)
+	if err != nil {
+		logf(request, "Join response: %v", err)
+	}
+	if errors.Is(err, auth.ErrTooManyAttempts) {
+		httpTooManyRequests(response, request, "Too many login attempts, try again later")
+	} else if errors.Is(err, game.ErrInviteNotFound) ||
+		errors.Is(err, game.ErrInviteUsedUp) ||
+		errors.Is(err, auth.ErrNotAuthorized) {
+		httpForbidden(response, request, "Unable to join with that invite")
+	} else if errors.Is(err, auth.ErrUsernameTaken) {
+		httpBadRequest(response, request, "That username is taken; log in to join with it")
+	} else if errors.Is(err, auth.ErrInvalidName) {
+		httpBadRequest(response, request, "name: invalid")
+	}
+	httpInternalErrorIf(response, request, err)
+	plr := joining.Player
+	// Players already logged in have given their second factor
+	if current == nil && requireSecondFactor(
+		response, request, plr, joining.Invite.GameID, join.Code, join.Persist, conn,
+	) {
+		return
+	}
+
+	gameInfo, err := auth.FinishJoin(joining, conn)
+	if errors.Is(err, game.ErrInviteNotFound) || errors.Is(err, game.ErrInviteUsedUp) {
+		httpForbidden(response, request, "Unable to join with that invite")
+	} else if errors.Is(err, auth.ErrUsernameTaken) {
+		httpBadRequest(response, request, "That username is taken; log in to join with it")
+	}
+	httpInternalErrorIf(response, request, err)
+	logf(request, "%v joined %v", plr.ID, gameInfo.ID)
+
+	session, err := session.New(gameInfo.ID, plr, join.Persist, requestUserAgent(request), conn)
+	httpInternalErrorIf(response, request, err)
+	logf(request, "Created session %v for %v", session.ID, plr.ID)
+
+	err = writeBodyJSON(response, loginResponse{
+		Player:   plr,
+		GameInfo: gameInfo,
+		Session:  string(session.ID),
+	})
+	httpInternalErrorIf(response, request, err)
+	httpSuccess(response, request,
+		session.Type(), " ", session.ID, " for ", session.PlayerID,
+		" in ", gameInfo.ID,
+	)
+}
+
+// POST /auth/verify-2fa { challenge, code } -> { login response }
+var _ = authRouter.HandleFunc("/verify-2fa", handleVerifySecondFactor).Methods("POST")
+
+func handleVerifySecondFactor(response Response, request *Request) {
+	logRequest(request)
+	var verify struct {
+		Challenge string `json:"challenge"`
+		Code      string `json:"code"`
+	}
+	err := readBodyJSON(request, &verify)
+	httpBadRequestIf(response, request, err)
+
+	conn := contextRedisConn(request.Context())
+	gameInfo, plr, persist, err := auth.FinishSecondFactor(verify.Challenge, verify.Code, conn)
+	if err != nil {
+		logf(request, "Second factor response: %v", err)
+	}
+	if errors.Is(err, auth.ErrChallengeNotFound) {
+		httpBadRequest(response, request, "That login has expired")
+	} else if errors.Is(err, auth.ErrTooManyAttempts) {
+		httpTooManyRequests(response, request, "Too many login attempts, try again later")
+	} else if errors.Is(err, auth.ErrNotAuthorized) {
+		httpForbidden(response, request, "Wrong code")
+	} else if errors.Is(err, game.ErrInviteNotFound) || errors.Is(err, game.ErrInviteUsedUp) {
+		httpForbidden(response, request, "Unable to join with that invite")
+	} else if errors.Is(err, game.ErrNotFound) {
+		httpForbidden(response, request, "Unable to log in to that game")
+	}
+	httpInternalErrorIf(response, request, err)
+
+	session, err := session.New(gameInfo.ID, plr, persist, requestUserAgent(request), conn)
+	httpInternalErrorIf(response, request, err)
+	logf(request, "Created session %v for %v", session.ID, plr.ID)
+
+	err = writeBodyJSON(response, loginResponse{
+		Player:   plr,
+		GameInfo: gameInfo,
+		Session:  string(session.ID),
+	})
+	httpInternalErrorIf(response, request, err)
+	httpSuccess(response, request,
+		session.Type(), " ", session.ID, " for ", session.PlayerID,
+		" in ", gameInfo.ID, " after second factor",
+	)
+}
+
 // POST /auth/reauth { session } -> { login response }
 var _ = authRouter.HandleFunc("/reauth", handleReauth).Methods("POST")
 
@@ -107,6 +268,21 @@ func handleReauth(response Response, request *Request) {
 	}
 	logf(request, "Confirmed game %s exists", sess.GameID)
 
+	if sess.Spectator {
+		requestRole(response, request, sess, conn)
+		gameInfo, err := game.GetInfo(sess.GameID, conn)
+		httpInternalErrorIf(response, request, err)
+		err = writeBodyJSON(response, loginResponse{
+			GameInfo: gameInfo,
+			Session:  string(sess.ID),
+		})
+		httpInternalErrorIf(response, request, err)
+		httpSuccess(response, request,
+			"Spectator ", sess.PlayerID, " reauthed for ", sess.GameID,
+		)
+		return
+	}
+
 	plr, err := player.GetByID(string(sess.PlayerID), conn)
 	if errors.Is(err, player.ErrNotFound) {
 		logf(request, "Player %v does not exist", sess.PlayerID)
@@ -136,6 +312,42 @@ func handleReauth(response Response, request *Request) {
 	)
 }
 
+// POST /auth/spectate { gameID } -> { game, session }
+var _ = authRouter.HandleFunc("/spectate", handleSpectate).Methods("POST")
+
+func handleSpectate(response Response, request *Request) {
+	logRequest(request)
+	var spectate struct {
+		GameID string `json:"gameID"`
+	}
+	err := readBodyJSON(request, &spectate)
+	httpBadRequestIf(response, request, err)
+	logf(request, "Spectate request for %v", spectate.GameID)
+
+	conn := contextRedisConn(request.Context())
+	// Don't distinguish missing games from games without spectators
+	allowed, err := game.AllowsSpectators(spectate.GameID, conn)
+	httpInternalErrorIf(response, request, err)
+	if !allowed {
+		httpForbidden(response, request, "Unable to spectate that game")
+	}
+	gameInfo, err := game.GetInfo(spectate.GameID, conn)
+	httpInternalErrorIf(response, request, err)
+
+	sess, err := session.NewSpectator(spectate.GameID, conn)
+	httpInternalErrorIf(response, request, err)
+	logf(request, "Created spectator session %v", sess.ID)
+
+	err = writeBodyJSON(response, loginResponse{
+		GameInfo: gameInfo,
+		Session:  string(sess.ID),
+	})
+	httpInternalErrorIf(response, request, err)
+	httpSuccess(response, request,
+		"Spectator ", sess.ID, " in ", spectate.GameID,
+	)
+}
+
 // POST auth/logout { session } -> OK
 
 var _ = authRouter.HandleFunc("/logout", handleLogout).Methods("POST")
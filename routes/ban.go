@@ -0,0 +1,154 @@
+package routes
+
+import (
+	"errors"
+	"sr/game"
+	"sr/id"
+	"sr/player"
+	"sr/session"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+type removePlayerRequest struct {
+	PlayerID id.UID `json:"playerID"`
+}
+
+// requireRemovable forbids removing the game's owner, the requester, or a GM
+// unless the requester can assign GMs. It returns whether the player is in
+// the game.
+func requireRemovable(response Response, request *Request, sess *session.Session, role game.Role, playerID id.UID, conn redis.Conn) bool {
+	if playerID == sess.PlayerID {
+		httpBadRequest(response, request, "You may not remove yourself.")
+	}
+	targetRole, err := game.GetRole(sess.GameID, playerID, conn)
+	if errors.Is(err, game.ErrNotInGame) {
+		return false
+	}
+	httpInternalErrorIf(response, request, err)
+	if targetRole == game.RoleOwner {
+		httpForbidden(response, request, "You may not remove the owner.")
+	}
+	if targetRole == game.RoleGM && !role.Can(game.PermissionAssignGMs) {
+		httpForbidden(response, request, "You may not remove a GM.")
+	}
+	return true
+}
+
+// removePlayer removes a player from the session's game and ends their
+// sessions in it. It returns false if the player was already removed, i.e. by
+// another request at the same time.
+func removePlayer(response Response, request *Request, sess *session.Session, playerID id.UID, reason string, conn redis.Conn) bool {
+	err := game.RemovePlayer(sess.GameID, playerID, reason, conn)
+	if errors.Is(err, game.ErrNotInGame) {
+		return false
+	}
+	httpInternalErrorIf(response, request, err)
+	removed, err := session.RemoveForPlayer(sess.GameID, playerID, conn)
+	httpInternalErrorIf(response, request, err)
+	logf(request, "Removed %v from %v, ending %v sessions", playerID, sess.GameID, removed)
+	return true
+}
+
+var _ = gameRouter.HandleFunc("/kick", handleKick).Methods("POST")
+
+// POST /kick { playerID } -> OK
+func handleKick(response Response, request *Request) {
+	logRequest(request)
+	sess, conn, err := requestSession(request)
+	httpUnauthorizedIf(response, request, err)
+	role := requirePermission(response, request, sess, conn, game.PermissionManagePlayers)
+
+	var kick removePlayerRequest
+	err = readBodyJSON(request, &kick)
+	httpBadRequestIf(response, request, err)
+
+	logf(request, "%v kicks %v", sess.PlayerInfo(), kick.PlayerID)
+	if !requireRemovable(response, request, sess, role, kick.PlayerID, conn) {
+		httpNotFound(response, request, "Player not found")
+	}
+	if !removePlayer(response, request, sess, kick.PlayerID, "kicked", conn) {
+		httpSuccess(response, request, "(Idempotent, no changes made)")
+		return
+	}
+	httpSuccess(response, request, "Kicked ", kick.PlayerID)
+}
+
+var _ = gameRouter.HandleFunc("/ban", handleBan).Methods("POST")
+
+// POST /ban { playerID } -> OK
+func handleBan(response Response, request *Request) {
+	logRequest(request)
+	sess, conn, err := requestSession(request)
+	httpUnauthorizedIf(response, request, err)
+	role := requirePermission(response, request, sess, conn, game.PermissionManagePlayers)
+
+	var ban removePlayerRequest
+	err = readBodyJSON(request, &ban)
+	httpBadRequestIf(response, request, err)
+
+	logf(request, "%v bans %v", sess.PlayerInfo(), ban.PlayerID)
+	inGame := requireRemovable(response, request, sess, role, ban.PlayerID, conn)
+	if !inGame {
+		exists, err := player.Exists(string(ban.PlayerID), conn)
+		httpInternalErrorIf(response, request, err)
+		if !exists {
+			httpNotFound(response, request, "Player not found")
+		}
+	}
+	_, err = game.SetBanned(sess.GameID, ban.PlayerID, true, conn)
+	httpInternalErrorIf(response, request, err)
+	if inGame && !removePlayer(response, request, sess, ban.PlayerID, "banned", conn) {
+		logf(request, "%v was already removed from %v", ban.PlayerID, sess.GameID)
+	}
+	httpSuccess(response, request, "Banned ", ban.PlayerID)
+}
+
+var _ = gameRouter.HandleFunc("/unban", handleUnban).Methods("POST")
+
+// POST /unban { playerID } -> OK
+func handleUnban(response Response, request *Request) {
+	logRequest(request)
+	sess, conn, err := requestSession(request)
+	httpUnauthorizedIf(response, request, err)
+	requirePermission(response, request, sess, conn, game.PermissionManagePlayers)
+
+	var unban removePlayerRequest
+	err = readBodyJSON(request, &unban)
+	httpBadRequestIf(response, request, err)
+
+	logf(request, "%v unbans %v", sess.PlayerInfo(), unban.PlayerID)
+	changed, err := game.SetBanned(sess.GameID, unban.PlayerID, false, conn)
+	httpInternalErrorIf(response, request, err)
+	if !changed {
+		httpSuccess(response, request, "(Idempotent, no changes made)")
+		return
+	}
+	httpSuccess(response, request, "Unbanned ", unban.PlayerID)
+}
+
+var _ = gameRouter.HandleFunc("/banned", handleGetBanned).Methods("GET")
+
+// GET /banned -> [playerInfo]
+func handleGetBanned(response Response, request *Request) {
+	logRequest(request)
+	sess, conn, err := requestSession(request)
+	httpUnauthorizedIf(response, request, err)
+	requirePermission(response, request, sess, conn, game.PermissionManagePlayers)
+
+	playerIDs, err := game.GetBanned(sess.GameID, conn)
+	httpInternalErrorIf(response, request, err)
+	banned := make([]player.Info, 0, len(playerIDs))
+	for _, playerID := range playerIDs {
+		plr, err := player.GetByID(playerID, conn)
+		if errors.Is(err, player.ErrNotFound) {
+			continue
+		}
+		httpInternalErrorIf(response, request, err)
+		banned = append(banned, plr.Info())
+	}
+
+	err = writeBodyJSON(response, banned)
+	httpInternalErrorIf(response, request, err)
+	httpSuccess(response, request, len(banned), " banned players")
+}
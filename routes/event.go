@@ -1,8 +1,11 @@
 package routes
 
 import (
+	"errors"
+	"fmt"
 	"sr/event"
 	"sr/game"
+	"strconv"
 )
 
 var _ = gameRouter.HandleFunc("/edit-share", handleShareEvent).Methods("POST")
@@ -16,6 +19,7 @@ func handleShareEvent(response Response, request *Request) {
 	logRequest(request)
 	sess, conn, err := requestSession(request)
 	httpUnauthorizedIf(response, request, err)
+	requirePermission(response, request, sess, conn, game.PermissionPost)
 
 	var shareRequest shareEventRequest
 	err = readBodyJSON(request, &shareRequest)
@@ -39,7 +43,7 @@ func handleShareEvent(response Response, request *Request) {
 	if evt.GetPlayerID() != sess.PlayerID {
 		httpForbidden(response, request, "You may not edit this event")
 	}
-	if evt.GetType() == event.EventTypePlayerJoin {
+	if !event.IsModifiable(evt) {
 		httpForbidden(response, request, "You may not edit this event")
 	}
 
@@ -56,3 +60,189 @@ func handleShareEvent(response Response, request *Request) {
 		"Event ", evt.GetID(), " is now share ", share.String(),
 	)
 }
+
+type eventHistoryResponse struct {
+	Event     event.Event   `json:"event"`
+	Revisions []event.Event `json:"revisions"`
+}
+
+var _ = gameRouter.HandleFunc("/event-history", handleEventHistory).Methods("GET")
+
+// GET /event-history ?id= -> { event, revisions: [oldest ... newest] }
+func handleEventHistory(response Response, request *Request) {
+	logRequest(request)
+	sess, conn, err := requestSession(request)
+	httpUnauthorizedIf(response, request, err)
+	requestRole(response, request, sess, conn)
+
+	eventID, err := strconv.ParseInt(request.FormValue("id"), 10, 64)
+	httpBadRequestIf(response, request, err)
+
+	eventText, err := event.GetByID(sess.GameID, eventID, conn)
+	httpNotFoundIf(response, request, err)
+	evt, err := event.Parse([]byte(eventText))
+	httpInternalErrorIf(response, request, err)
+
+	plr := requestViewer(response, request, sess, conn)
+	if !game.PlayerCanSeeEvent(plr, evt) {
+		httpNotFound(response, request, "Event not found")
+	}
+
+	revisionTexts, err := event.GetRevisions(sess.GameID, eventID, conn)
+	httpInternalErrorIf(response, request, err)
+	revisions := make([]event.Event, len(revisionTexts))
+	for i, revisionText := range revisionTexts {
+		revision, err := event.Parse([]byte(revisionText))
+		if err != nil {
+			err = fmt.Errorf("error parsing revision %v: %w", i, err)
+			httpInternalErrorIf(response, request, err)
+		}
+		revisions[i] = revision
+	}
+
+	err = writeBodyJSON(response, eventHistoryResponse{
+		Event:     evt,
+		Revisions: revisions,
+	})
+	httpInternalErrorIf(response, request, err)
+	httpSuccess(response, request,
+		"Event ", eventID, ": ", len(revisions), " revisions",
+	)
+}
+
+var _ = gameRouter.HandleFunc("/trash", handleTrash).Methods("GET")
+
+// GET /trash -> [{ event, deletedAt }]
+// Only GMs can see what was deleted, and only events they could see before.
+func handleTrash(response Response, request *Request) {
+	logRequest(request)
+	sess, conn, err := requestSession(request)
+	httpUnauthorizedIf(response, request, err)
+	requirePermission(response, request, sess, conn, game.PermissionModerate)
+
+	plr := requestViewer(response, request, sess, conn)
+
+	trash, err := game.GetTrash(sess.GameID, conn)
+	httpInternalErrorIf(response, request, err)
+	visible := make([]game.TrashedEvent, 0, len(trash))
+	for _, trashed := range trash {
+		if game.PlayerCanSeeEvent(plr, trashed.Event) {
+			visible = append(visible, trashed)
+		}
+	}
+
+	err = writeBodyJSON(response, visible)
+	httpInternalErrorIf(response, request, err)
+	httpSuccess(response, request,
+		len(visible), " of ", len(trash), " deleted events in ", sess.GameID,
+	)
+}
+
+var _ = gameRouter.HandleFunc("/restore", handleRestoreEvent).Methods("POST")
+
+type restoreEventRequest struct {
+	ID int64 `json:"id"`
+}
+
+// POST /restore { id } -> OK
+func handleRestoreEvent(response Response, request *Request) {
+	logRequest(request)
+	sess, conn, err := requestSession(request)
+	httpUnauthorizedIf(response, request, err)
+	role := requirePermission(response, request, sess, conn, game.PermissionPost)
+
+	var restore restoreEventRequest
+	err = readBodyJSON(request, &restore)
+	httpBadRequestIf(response, request, err)
+
+	logf(request,
+		"%v requests to restore %v", sess.PlayerInfo(), restore.ID,
+	)
+	evt, err := game.GetTrashedEvent(sess.GameID, restore.ID, conn)
+	if errors.Is(err, game.ErrNotInTrash) {
+		httpNotFoundIf(response, request, err)
+	}
+	httpInternalErrorIf(response, request, err)
+
+	if evt.GetPlayerID() != sess.PlayerID && !role.Can(game.PermissionModerate) {
+		httpForbidden(response, request, "You may not restore this event.")
+	}
+
+	err = game.RestoreEvent(sess.GameID, evt.GetID(), conn)
+	if errors.Is(err, game.ErrNotInTrash) {
+		httpNotFoundIf(response, request, err)
+	}
+	httpInternalErrorIf(response, request, err)
+	httpSuccess(response, request, "Restored event ", evt.GetID())
+}
+
+type chatRequest struct {
+	Text  string `json:"text"`
+	Share int    `json:"share"`
+}
+
+var _ = gameRouter.HandleFunc("/chat", handleChat).Methods("POST")
+
+// POST /chat { text, share } -> OK
+func handleChat(response Response, request *Request) {
+	logRequest(request)
+	sess, conn, err := requestSession(request)
+	httpUnauthorizedIf(response, request, err)
+	requirePermission(response, request, sess, conn, game.PermissionPost)
+
+	var chat chatRequest
+	err = readBodyJSON(request, &chat)
+	httpBadRequestIf(response, request, err)
+
+	if !event.IsShare(chat.Share) {
+		httpBadRequest(response, request, "share: invalid")
+	}
+	share := event.Share(chat.Share)
+	text, ok := event.LimitChatText(chat.Text)
+	if !ok {
+		httpBadRequest(response, request, "text: invalid")
+	}
+
+	player, err := sess.GetPlayer(conn)
+	httpInternalErrorIf(response, request, err)
+
+	evt := event.ForChat(player, share, text)
+	err = game.PostEvent(sess.GameID, &evt, conn)
+	httpInternalErrorIf(response, request, err)
+	httpSuccess(response, request,
+		"Chat ", evt.GetID(), " posted ", share.String(),
+	)
+}
+
+type pinRequest struct {
+	ID     int64 `json:"id"`
+	Pinned bool  `json:"pinned"`
+}
+
+var _ = gameRouter.HandleFunc("/pin", handlePin).Methods("POST")
+
+// POST /pin { id, pinned } -> OK
+func handlePin(response Response, request *Request) {
+	logRequest(request)
+	sess, conn, err := requestSession(request)
+	httpUnauthorizedIf(response, request, err)
+	requirePermission(response, request, sess, conn, game.PermissionPin)
+
+	var pin pinRequest
+	err = readBodyJSON(request, &pin)
+	httpBadRequestIf(response, request, err)
+
+	logf(request, "%v sets pinned %v on %v", sess.PlayerInfo(), pin.Pinned, pin.ID)
+	evt := requestVisibleEvent(response, request, sess, pin.ID, conn)
+	if pin.Pinned && evt.GetShare() != event.ShareInGame {
+		httpBadRequest(response, request, "Only events shared with the game can be pinned")
+	}
+
+	changed, err := game.SetPinned(sess.GameID, pin.ID, pin.Pinned, conn)
+	httpInternalErrorIf(response, request, err)
+	if !changed {
+		httpSuccess(response, request, "(Idempotent, no changes made)")
+		return
+	}
+	httpSuccess(response, request, "Event ", pin.ID, " pinned = ", pin.Pinned)
+}
@@ -0,0 +1,51 @@
+package routes
+
+import (
+	"fmt"
+	"sr/event"
+	"sr/export"
+	"sr/game"
+)
+
+var _ = gameRouter.HandleFunc("/export", handleExport).Methods("GET")
+
+// GET /export ?format=json|csv|md -> game history file
+func handleExport(response Response, request *Request) {
+	logRequest(request)
+	sess, conn, err := requestSession(request)
+	httpUnauthorizedIf(response, request, err)
+	requestRole(response, request, sess, conn)
+
+	formatText := request.FormValue("format")
+	if formatText == "" {
+		formatText = string(export.FormatJSON)
+	}
+	format, ok := export.ParseFormat(formatText)
+	if !ok {
+		httpBadRequest(response, request, "Invalid export format")
+	}
+
+	plr := requestViewer(response, request, sess, conn)
+	logf(request, "%v exports %v as %v", sess.PlayerInfo(), sess.GameID, format)
+
+	response.Header().Set("Content-Type", format.ContentType())
+	response.Header().Set("Content-Disposition", fmt.Sprintf(
+		`attachment; filename="%v.%v"`, sess.GameID, format.Extension(),
+	))
+	count := 0
+	err = export.Game(sess.GameID, format, response, func(evt event.Event) bool {
+		if !game.PlayerCanSeeEvent(plr, evt) {
+			return false
+		}
+		count++
+		return true
+	}, conn)
+	if err != nil {
+		// Part of the file may have been written, so it's too late for an error status.
+		logf(request, "Export of %v failed after %v events: %v", sess.GameID, count, err)
+		return
+	}
+	httpSuccess(response, request,
+		"Exported ", count, " events from ", sess.GameID, " as ", format,
+	)
+}
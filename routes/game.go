@@ -2,6 +2,7 @@ package routes
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"reflect"
 	"sr"
@@ -9,7 +10,8 @@ import (
 	"sr/event"
 	"sr/game"
 	"sr/id"
-	"sr/update"
+	"strconv"
+	"time"
 )
 
 var gameRouter = restRouter.PathPrefix("/game").Subrouter()
@@ -21,6 +23,7 @@ func handleInfo(response Response, request *Request) {
 	logRequest(request)
 	sess, conn, err := requestSession(request)
 	httpUnauthorizedIf(response, request, err)
+	requestRole(response, request, sess, conn)
 
 	info, err := game.GetInfo(sess.GameID, conn)
 	httpInternalErrorIf(response, request, err)
@@ -33,6 +36,52 @@ func handleInfo(response Response, request *Request) {
 	)
 }
 
+type createGameResponse struct {
+	GameInfo *game.Info   `json:"game"`
+	Invite   *game.Invite `json:"invite"`
+}
+
+var _ = gameRouter.HandleFunc("/create", handleNewGame).Methods("POST")
+
+// POST /create -> { game: {gameInfo}, invite }
+func handleNewGame(response Response, request *Request) {
+	logRequest(request)
+	sess, conn, err := requestSession(request)
+	httpUnauthorizedIf(response, request, err)
+	requirePlayerSession(response, request, sess)
+
+	plr, err := sess.GetPlayer(conn)
+	httpInternalErrorIf(response, request, err)
+
+	var gameID string
+	for i := 0; i < config.RedisRetries; i++ {
+		gameID = string(id.GenGameID())
+		err = game.Create(gameID, plr, conn)
+		if !errors.Is(err, game.ErrExists) {
+			break
+		}
+	}
+	httpInternalErrorIf(response, request, err)
+	logf(request, "%v created game %v", sess.PlayerInfo(), gameID)
+
+	invite, err := game.CreateInvite(
+		gameID, plr.ID, game.RolePlayer, config.DefaultInviteUses,
+		time.Duration(config.DefaultInviteHours)*time.Hour, conn,
+	)
+	httpInternalErrorIf(response, request, err)
+	logf(request, "Created invite %v for %v", invite.Code, gameID)
+
+	info, err := game.GetInfo(gameID, conn)
+	httpInternalErrorIf(response, request, err)
+
+	err = writeBodyJSON(response, createGameResponse{
+		GameInfo: info,
+		Invite:   invite,
+	})
+	httpInternalErrorIf(response, request, err)
+	httpSuccess(response, request, "Created game ", gameID)
+}
+
 type renameRequest struct {
 	Name string `json:"name"`
 }
@@ -43,6 +92,7 @@ func handleUpdateEvent(response Response, request *Request) {
 	logRequest(request)
 	sess, conn, err := requestSession(request)
 	httpUnauthorizedIf(response, request, err)
+	requirePermission(response, request, sess, conn, game.PermissionPost)
 
 	var updateRequest updateEventRequest
 	err = readBodyJSON(request, &updateRequest)
@@ -60,39 +110,45 @@ func handleUpdateEvent(response Response, request *Request) {
 	if evt.GetPlayerID() != sess.PlayerID {
 		httpForbidden(response, request, "You may not update this event.")
 	}
-	if evt.GetType() == event.EventTypePlayerJoin {
+	if !event.IsModifiable(evt) {
 		httpForbidden(response, request, "You may not update this event.")
 	}
 
 	logf(request, "Event type %v found, updating", evt.GetType())
-	updateTime := id.NewEventID()
-	evt.SetEdit(updateTime)
 	diff := make(map[string]interface{})
 	for key, value := range updateRequest.Diff {
 		switch key {
 		// Title: the player can set the event title.
 		case "title":
+			if !eventHasField(evt, "Title") {
+				httpBadRequest(response, request, "Event diff: title: event has no title")
+			}
 			title, ok := value.(string)
 			if !ok {
 				httpBadRequest(response, request, "Event diff: title: expected string")
 			}
-			// Title is common to many events to be worth type switch
-			titleField := reflect.Indirect(reflect.ValueOf(evt)).FieldByName("Title")
-			if !titleField.CanSet() {
-				httpInternalError(response, request, "Cannot set Title field")
-			}
-			titleField.SetString(title)
 			diff["title"] = title
+		case "text":
+			if _, ok := evt.(*event.Chat); !ok {
+				httpBadRequest(response, request, "Event diff: text: only chat has text")
+			}
+			text, ok := value.(string)
+			if !ok {
+				httpBadRequest(response, request, "Event diff: text: expected string")
+			}
+			text, ok = event.LimitChatText(text)
+			if !ok {
+				httpBadRequest(response, request, "Event diff: text: invalid")
+			}
+			diff["text"] = text
 		case "glitchy":
+			if !eventHasField(evt, "Glitchy") {
+				httpBadRequest(response, request, "Event diff: glitchy: event has no glitchy")
+			}
 			glitchy, ok := value.(float64)
 			if !ok {
 				httpBadRequest(response, request, "Event diff: glitchy: expected int")
 			}
-			glitchyField := reflect.Indirect(reflect.ValueOf(evt)).FieldByName("Glitchy")
-			if !glitchyField.CanSet() {
-				httpInternalError(response, request, "Cannot set Glitchy field")
-			}
-			glitchyField.SetInt(int64(glitchy))
 			diff["glitchy"] = glitchy
 		case "share":
 			httpBadRequest(response, request, "Event diff: cannot update share here")
@@ -100,13 +156,56 @@ func handleUpdateEvent(response Response, request *Request) {
 			logf(request, "Received unknown value %v = %v", key, value)
 		}
 	}
-	update := update.ForEventDiff(evt, diff)
+
+	if len(diff) == 0 {
+		httpSuccess(response, request, "(Idempotent, no changes made)")
+		return
+	}
 
 	logf(request, "Event %v diff %v", evt.GetID(), diff)
-	err = game.UpdateEvent(sess.GameID, evt, update, conn)
+	updateTime := id.NewEventID()
+	err = game.ReviseEvent(sess.GameID, evt.GetID(), func(evt event.Event) (map[string]interface{}, error) {
+		evt.SetEdit(updateTime)
+		return diff, applyEventDiff(evt, diff)
+	}, conn)
 	httpInternalErrorIf(response, request, err)
 }
 
+// eventHasField determines if an event has a settable field, for the fields
+// applyEventDiff sets by reflection.
+func eventHasField(evt event.Event, field string) bool {
+	return reflect.Indirect(reflect.ValueOf(evt)).FieldByName(field).CanSet()
+}
+
+// applyEventDiff sets the fields of a checked diff from /modify-roll on an
+// event.
+func applyEventDiff(evt event.Event, diff map[string]interface{}) error {
+	for key, value := range diff {
+		switch key {
+		case "title":
+			// Title is common to many events to be worth type switch
+			titleField := reflect.Indirect(reflect.ValueOf(evt)).FieldByName("Title")
+			if !titleField.CanSet() {
+				return fmt.Errorf("cannot set Title field of %v", evt.GetType())
+			}
+			titleField.SetString(value.(string))
+		case "text":
+			chat, ok := evt.(*event.Chat)
+			if !ok {
+				return fmt.Errorf("cannot set text of %v", evt.GetType())
+			}
+			chat.Text = value.(string)
+		case "glitchy":
+			glitchyField := reflect.Indirect(reflect.ValueOf(evt)).FieldByName("Glitchy")
+			if !glitchyField.CanSet() {
+				return fmt.Errorf("cannot set Glitchy field of %v", evt.GetType())
+			}
+			glitchyField.SetInt(int64(value.(float64)))
+		}
+	}
+	return nil
+}
+
 var _ = gameRouter.HandleFunc("/delete-roll", handleDeleteEvent).Methods("POST")
 
 type deleteEventRequest struct {
@@ -117,6 +216,7 @@ func handleDeleteEvent(response Response, request *Request) {
 	logRequest(request)
 	sess, conn, err := requestSession(request)
 	httpUnauthorizedIf(response, request, err)
+	role := requirePermission(response, request, sess, conn, game.PermissionPost)
 
 	var delete deleteEventRequest
 	err = readBodyJSON(request, &delete)
@@ -131,10 +231,10 @@ func handleDeleteEvent(response Response, request *Request) {
 	evt, err := event.Parse([]byte(eventText))
 	httpBadRequestIf(response, request, err)
 
-	if evt.GetPlayerID() != sess.PlayerID {
+	if evt.GetPlayerID() != sess.PlayerID && !role.Can(game.PermissionModerate) {
 		httpForbidden(response, request, "You may not delete this event.")
 	}
-	if evt.GetType() == event.EventTypePlayerJoin {
+	if !event.IsModifiable(evt) {
 		httpForbidden(response, request, "You may not delete this event.")
 	}
 
@@ -162,6 +262,7 @@ func handleRoll(response Response, request *Request) {
 	logRequest(request)
 	sess, conn, err := requestSession(request)
 	httpUnauthorizedIf(response, request, err)
+	requirePermission(response, request, sess, conn, game.PermissionPost)
 
 	var roll rollRequest
 	err = readBodyJSON(request, &roll)
@@ -217,10 +318,17 @@ type rerollRequest struct {
 
 var _ = gameRouter.HandleFunc("/reroll", handleReroll).Methods("POST")
 
+// errAlreadyRerolled means a roll was already rerolled with Second Chance.
+var errAlreadyRerolled = errors.New("roll already rerolled")
+
+// errInvalidReroll means a roll can't be rerolled with Second Chance.
+var errInvalidReroll = errors.New("invalid roll to reroll")
+
 func handleReroll(response Response, request *Request) {
 	logRequest(request)
 	sess, conn, err := requestSession(request)
 	httpUnauthorizedIf(response, request, err)
+	requirePermission(response, request, sess, conn, game.PermissionPost)
 
 	var reroll rerollRequest
 	err = readBodyJSON(request, &reroll)
@@ -235,9 +343,9 @@ func handleReroll(response Response, request *Request) {
 	)
 
 	previousRollText, err := event.GetByID(sess.GameID, reroll.RollID, conn)
-	httpInternalErrorIf(response, request, err)
+	httpBadRequestIf(response, request, err)
 	previousRollType := event.ParseTy(previousRollText)
-	if previousRollType != "roll" {
+	if previousRollType != event.EventTypeRoll {
 		httpBadRequest(response, request, "Invalid previous roll type")
 	}
 
@@ -250,27 +358,42 @@ func handleReroll(response Response, request *Request) {
 	logf(request, "Got previous roll `%v` %v",
 		previousRoll.Title, previousRoll.Dice,
 	)
+	if previousRoll.GetPlayerID() != sess.PlayerID {
+		httpForbidden(response, request, "You may not reroll this event.")
+	}
+	if len(previousRoll.Reroll) != 0 {
+		httpBadRequest(response, request, "Roll has already been rerolled")
+	}
 
-	newRound := sr.RerollFailures(previousRoll.Dice)
-	if len(newRound) == 0 {
-		// Cannot reroll failures on all hits
+	// Check the roll again as it's stored, in case it was rerolled meanwhile
+	var newRound []int
+	updateTime := id.NewEventID()
+	err = game.ReviseEvent(sess.GameID, previousRoll.ID, func(evt event.Event) (map[string]interface{}, error) {
+		roll, ok := evt.(*event.Roll)
+		if !ok {
+			return nil, fmt.Errorf("%w: event %v is %v", errInvalidReroll, evt.GetID(), evt.GetType())
+		}
+		if len(roll.Reroll) != 0 {
+			return nil, fmt.Errorf("%w: %v", errAlreadyRerolled, roll.ID)
+		}
+		newRound = sr.RerollFailures(roll.Dice)
+		if len(newRound) == 0 {
+			// Cannot reroll failures on all hits
+			return nil, fmt.Errorf("%w: %v has no failures", errInvalidReroll, roll.ID)
+		}
+		roll.Reroll = newRound
+		roll.SetEdit(updateTime)
+		return map[string]interface{}{"reroll": newRound}, nil
+	}, conn)
+	if errors.Is(err, errAlreadyRerolled) {
+		httpBadRequest(response, request, "Roll has already been rerolled")
+	} else if errors.Is(err, errInvalidReroll) {
 		httpBadRequest(response, request, "Invalid previous roll")
 	}
-
-	player, err := sess.GetPlayer(conn)
-	httpInternalErrorIf(response, request, err)
-
-	rerolled := event.ForReroll(
-		player, &previousRoll, [][]int{newRound, previousRoll.Dice},
-	)
-	//update := update.ForSecondChance(&rerolled, newRound)
-	err = game.DeleteEvent(sess.GameID, &previousRoll, conn)
-	httpInternalErrorIf(response, request, err)
-	err = game.PostEvent(sess.GameID, &rerolled, conn)
 	httpInternalErrorIf(response, request, err)
 
 	httpSuccess(
-		response, request, "Rerolled ", rerolled.ID, newRound,
+		response, request, "Rerolled ", previousRoll.ID, " ", newRound,
 	)
 }
 
@@ -303,20 +426,39 @@ var _ = gameRouter.HandleFunc("/events", handleEvents).Methods("GET")
   -> [ {id: <some-early-id>, ... } ]
   if there's < max responses, client knows it's hit the boundary.
 */
-// GET /event-range { start: <id>, end: <id>, max: int }
+// GET /event-range { start: <id>, end: <id>, max: int, scene: <id>? }
 func handleEvents(response Response, request *Request) {
 	logRequest(request)
 	sess, conn, err := requestSession(request)
 	httpUnauthorizedIf(response, request, err)
+	requestRole(response, request, sess, conn)
 
 	newest := request.FormValue("newest")
 	oldest := request.FormValue("oldest")
+	sceneText := request.FormValue("scene")
 
 	// We want to be careful here because these IDs are user input!
 
+	var sceneID int64
+	if sceneText != "" {
+		sceneID, err = strconv.ParseInt(sceneText, 10, 64)
+		httpBadRequestIf(response, request, err)
+		scene, err := game.GetScene(sess.GameID, sceneID, conn)
+		if errors.Is(err, game.ErrSceneNotFound) {
+			httpNotFound(response, request, "Scene not found")
+		}
+		httpInternalErrorIf(response, request, err)
+		if newest == "" {
+			newest = scene.Newest()
+		}
+		if oldest == "" {
+			oldest = sceneText
+		}
+	}
+
 	if newest == "" {
 		newest = "+inf"
-	} else if !event.ValidID(newest) {
+	} else if newest != "+inf" && !event.ValidID(newest) {
 		httpBadRequest(response, request, "Invalid newest ID")
 	}
 
@@ -330,8 +472,7 @@ func handleEvents(response Response, request *Request) {
 		oldest, newest, sess.PlayerInfo(),
 	)
 
-	plr, err := sess.GetPlayer(conn)
-	httpInternalErrorIf(response, request, err)
+	plr := requestViewer(response, request, sess, conn)
 	events, err := event.GetBetween(
 		sess.GameID, newest, oldest, config.MaxEventRange, conn,
 	)
@@ -358,6 +499,9 @@ func handleEvents(response Response, request *Request) {
 			if !game.PlayerCanSeeEvent(plr, evt) {
 				continue
 			}
+			if sceneID != 0 && evt.GetScene() != sceneID {
+				continue
+			}
 			parsed = append(parsed, evt)
 		}
 		if len(parsed) == 0 {
@@ -8,7 +8,7 @@ import (
 	"sr/event"
 	"sr/game"
 	"sr/id"
-	"sr/player"
+	"sr/session"
 	"sr/shutdownHandler"
 	"time"
 
@@ -44,6 +44,7 @@ func handleSubscription(response Response, request *Request) {
 	logRequest(request)
 	sess, conn, err := requestParamSession(request)
 	httpUnauthorizedIf(response, request, err)
+	requestRole(response, request, sess, conn)
 	logf(request, "Player %v to connect to %v", sess.PlayerID, sess.GameID)
 
 	// Get shutdown handler first so it defers after everything else
@@ -64,7 +65,9 @@ func handleSubscription(response Response, request *Request) {
 	ctx, cancel := context.WithCancel(request.Context())
 	messages := make(chan game.Message)
 	errors := make(chan error, 1)
-	err = game.Subscribe(ctx, sess.GameID, sess.PlayerID, messages, errors)
+	err = game.Subscribe(
+		ctx, sess.GameID, sess.PlayerID, session.CloseChannel(sess.ID), messages, errors,
+	)
 	httpInternalErrorIf(response, request, err)
 	logf(request, "Subscription task for %v established", sess.GameID)
 	defer cancel()
@@ -81,21 +84,31 @@ func handleSubscription(response Response, request *Request) {
 		}
 	}()
 
-	// Update player online status
-	_, err = game.UpdatePlayerConnections(
-		sess.GameID, sess.PlayerID, player.IncreaseConnections, conn,
-	)
-	httpInternalErrorIf(response, request, err)
-	logf(request, "Incremented online status for %v", sess.PlayerID)
-	defer func() {
-		if _, err := game.UpdatePlayerConnections(
-			sess.GameID, sess.PlayerID, player.DecreaseConnections, conn,
-		); err != nil {
-			logf(request, "^^ Error decrementing player connections: %v", err)
-		} else {
-			logf(request, "^^ Update online %v for %v", sess.ID, sess.PlayerID)
+	// Update player presence; spectators aren't players
+	connectionID := string(id.GenSessionID())
+	heartbeat := func() error { return nil }
+	if !sess.Spectator {
+		heartbeat = func() error {
+			if err := game.Heartbeat(sess.GameID, sess.PlayerID, connectionID, conn); err != nil {
+				return err
+			}
+			return game.CheckIdle(sess.GameID, sess.PlayerID, conn)
 		}
-	}()
+		err = game.MarkActive(sess.GameID, sess.PlayerID, conn)
+		httpInternalErrorIf(response, request, err)
+		err = heartbeat()
+		httpInternalErrorIf(response, request, err)
+		logf(request, "Connected %v to %v", sess.PlayerID, sess.GameID)
+		defer func() {
+			if err := game.Disconnect(
+				sess.GameID, sess.PlayerID, connectionID, conn,
+			); err != nil {
+				logf(request, "^^ Error disconnecting player: %v", err)
+			} else {
+				logf(request, "^^ Disconnected %v for %v", sess.ID, sess.PlayerID)
+			}
+		}()
+	}
 
 	// Log total time for response
 	defer func() {
@@ -123,10 +136,20 @@ func handleSubscription(response Response, request *Request) {
 				logf(request, "Unable to write to stream: %v", err)
 				return
 			}
+			if err = heartbeat(); err != nil {
+				logf(request, "Error updating presence: %v", err)
+			}
 			lastPing = now
 		}
 		select { // Receive message/error and wait out interval
 		case message := <-messages:
+			if message.Type == game.MessageTypeClose {
+				logf(request, "Closing subscription: %v", message.Body)
+				if err = stream.WriteEvent("close", []byte(message.Body)); err != nil {
+					logf(request, "Unable to write to stream: %v", err)
+				}
+				return
+			}
 			updateLog, err := writeMessageToStream(&message, stream)
 			if err != nil {
 				logf(request, "Error writing %v to stream", message.Body)
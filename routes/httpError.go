@@ -59,6 +59,10 @@ func httpUnauthorized(response Response, request *Request, message string) {
 	httpDoMessage("Unauthorized", http.StatusUnauthorized, response, request, message)
 }
 
+func httpTooManyRequests(response Response, request *Request, message string) {
+	httpDoMessage("Too Many Requests", http.StatusTooManyRequests, response, request, message)
+}
+
 func httpInternalErrorIf(response Response, request *Request, err error) {
 	httpDoErrorIf("Internal Server Error", http.StatusInternalServerError, response, request, err)
 }
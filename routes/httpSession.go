@@ -3,6 +3,7 @@ package routes
 import (
 	"errors"
 	"github.com/gomodule/redigo/redis"
+	"sr/game"
 	redisUtil "sr/redis"
 	"sr/session"
 	"strings"
@@ -42,9 +43,24 @@ func requestSession(request *Request) (*session.Session, redis.Conn, error) {
 		redisUtil.Close(conn)
 		return nil, nil, err
 	}
+	if err = session.Touch(conn); err != nil {
+		logf(request, "Unable to update last seen of %v: %v", session.ID, err)
+	}
 	return session, conn, nil
 }
 
+// markActive records that the session's player did something in its game, so
+// they aren't shown as away. Only requests the player makes themselves, not
+// ones their client makes in the background, should mark them active.
+func markActive(request *Request, sess *session.Session, conn redis.Conn) {
+	if sess.Spectator {
+		return
+	}
+	if err := game.MarkActive(sess.GameID, sess.PlayerID, conn); err != nil {
+		logf(request, "Unable to mark %v active: %v", sess.PlayerID, err)
+	}
+}
+
 func requestParamSession(request *Request) (*session.Session, redis.Conn, error) {
 	sessionID, err := sessionFromParams(request)
 	if err != nil {
@@ -56,5 +72,21 @@ func requestParamSession(request *Request) (*session.Session, redis.Conn, error)
 		redisUtil.Close(conn)
 		return nil, nil, err
 	}
+	if err = session.Touch(conn); err != nil {
+		logf(request, "Unable to update last seen of %v: %v", session.ID, err)
+	}
 	return session, conn, nil
 }
+
+// maxUserAgentLength is the most of a request's user agent stored with its
+// session.
+const maxUserAgentLength = 256
+
+// requestUserAgent retrieves the request's user agent to describe its session.
+func requestUserAgent(request *Request) string {
+	userAgent := request.UserAgent()
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+	return userAgent
+}
@@ -1,12 +1,12 @@
 package routes
 
 import (
+	"fmt"
 	"math"
 	"sr"
 	"sr/event"
 	"sr/game"
 	"sr/id"
-	"sr/update"
 )
 
 type initiativeRollRequest struct {
@@ -25,6 +25,7 @@ func handleRollInitiative(response Response, request *Request) {
 	logRequest(request)
 	sess, conn, err := requestSession(request)
 	httpUnauthorizedIf(response, request, err)
+	requirePermission(response, request, sess, conn, game.PermissionPost)
 
 	var roll initiativeRollRequest
 	err = readBodyJSON(request, &roll)
@@ -74,6 +75,7 @@ func handleEditInitiative(response Response, request *Request) {
 	logRequest(request)
 	sess, conn, err := requestSession(request)
 	httpUnauthorizedIf(response, request, err)
+	requirePermission(response, request, sess, conn, game.PermissionPost)
 
 	var updateRequest updateEventRequest
 	err = readBodyJSON(request, &updateRequest)
@@ -99,8 +101,6 @@ func handleEditInitiative(response Response, request *Request) {
 	}
 
 	initEvent := evt.(*event.InitiativeRoll)
-	updateTime := id.NewEventID()
-	initEvent.SetEdit(updateTime)
 	diff := make(map[string]interface{})
 	for key, value := range updateRequest.Diff {
 		switch key {
@@ -145,10 +145,28 @@ func handleEditInitiative(response Response, request *Request) {
 	}
 	if len(diff) == 0 {
 		httpSuccess(response, request, "(Idempotent, no changes made)")
+		return
 	}
-	update := update.ForEventDiff(initEvent, diff)
 	logf(request, "Found diff %v", diff)
-	err = game.UpdateEvent(sess.GameID, initEvent, update, conn)
+	updateTime := id.NewEventID()
+	err = game.ReviseEvent(sess.GameID, initEvent.GetID(), func(evt event.Event) (map[string]interface{}, error) {
+		stored, ok := evt.(*event.InitiativeRoll)
+		if !ok {
+			return nil, fmt.Errorf("event %v is not an initiative roll", evt.GetID())
+		}
+		stored.SetEdit(updateTime)
+		for key := range diff {
+			switch key {
+			case "title":
+				stored.Title = initEvent.Title
+			case "base":
+				stored.Base = initEvent.Base
+			case "seized":
+				stored.Seized = initEvent.Seized
+			}
+		}
+		return diff, nil
+	}, conn)
 	httpInternalErrorIf(response, request, err)
 	httpSuccess(response, request, "Update sent")
 }
@@ -0,0 +1,96 @@
+package routes
+
+import (
+	"errors"
+	"sr/config"
+	"sr/game"
+	"time"
+)
+
+type createInviteRequest struct {
+	Role  string `json:"role"`
+	Uses  int    `json:"uses"`
+	Hours int    `json:"hours"`
+}
+
+var _ = gameRouter.HandleFunc("/create-invite", handleCreateInvite).Methods("POST")
+
+// POST /create-invite { role, uses, hours } -> invite
+func handleCreateInvite(response Response, request *Request) {
+	logRequest(request)
+	sess, conn, err := requestSession(request)
+	httpUnauthorizedIf(response, request, err)
+	requirePermission(response, request, sess, conn, game.PermissionManagePlayers)
+
+	var create createInviteRequest
+	err = readBodyJSON(request, &create)
+	httpBadRequestIf(response, request, err)
+	if create.Role == "" {
+		create.Role = string(game.RolePlayer)
+	}
+	role := game.Role(create.Role)
+	if role != game.RolePlayer && role != game.RoleSpectator {
+		httpBadRequest(response, request, "role: must be player or spectator")
+	}
+	if create.Uses < 1 || create.Uses > config.MaxInviteUses {
+		httpBadRequest(response, request, "uses: out of range")
+	}
+	if create.Hours < 1 || create.Hours > config.MaxInviteHours {
+		httpBadRequest(response, request, "hours: out of range")
+	}
+
+	invite, err := game.CreateInvite(
+		sess.GameID, sess.PlayerID, role, create.Uses,
+		time.Duration(create.Hours)*time.Hour, conn,
+	)
+	httpInternalErrorIf(response, request, err)
+	logf(request, "%v created invite %v", sess.PlayerInfo(), invite.Code)
+
+	err = writeBodyJSON(response, invite)
+	httpInternalErrorIf(response, request, err)
+	httpSuccess(response, request,
+		"Invite ", invite.Code, " for ", invite.Uses, " ", role, "s",
+	)
+}
+
+var _ = gameRouter.HandleFunc("/invites", handleGetInvites).Methods("GET")
+
+// GET /invites -> [invite]
+func handleGetInvites(response Response, request *Request) {
+	logRequest(request)
+	sess, conn, err := requestSession(request)
+	httpUnauthorizedIf(response, request, err)
+	requirePermission(response, request, sess, conn, game.PermissionManagePlayers)
+
+	invites, err := game.GetInvites(sess.GameID, conn)
+	httpInternalErrorIf(response, request, err)
+
+	err = writeBodyJSON(response, invites)
+	httpInternalErrorIf(response, request, err)
+	httpSuccess(response, request, len(invites), " invites")
+}
+
+type revokeInviteRequest struct {
+	Code string `json:"code"`
+}
+
+var _ = gameRouter.HandleFunc("/revoke-invite", handleRevokeInvite).Methods("POST")
+
+// POST /revoke-invite { code } -> OK
+func handleRevokeInvite(response Response, request *Request) {
+	logRequest(request)
+	sess, conn, err := requestSession(request)
+	httpUnauthorizedIf(response, request, err)
+	requirePermission(response, request, sess, conn, game.PermissionManagePlayers)
+
+	var revoke revokeInviteRequest
+	err = readBodyJSON(request, &revoke)
+	httpBadRequestIf(response, request, err)
+
+	err = game.RevokeInvite(sess.GameID, revoke.Code, conn)
+	if errors.Is(err, game.ErrInviteNotFound) {
+		httpNotFound(response, request, "Invite not found")
+	}
+	httpInternalErrorIf(response, request, err)
+	httpSuccess(response, request, "Revoked invite ", revoke.Code)
+}
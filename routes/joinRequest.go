@@ -0,0 +1,196 @@
+package routes
+
+import (
+	"errors"
+	"sr/auth"
+	"sr/game"
+	"sr/session"
+)
+
+type joinRequestResponse struct {
+	ID     string `json:"id"`
+	Token  string `json:"token"`
+	Status string `json:"status"`
+}
+
+// POST /auth/request-join { gameID, username, name, passphrase } -> { id, token, status }
+// Logged in players ask to join as themselves with their session.
+var _ = authRouter.HandleFunc("/request-join", handleRequestJoin).Methods("POST")
+
+func handleRequestJoin(response Response, request *Request) {
+	logRequest(request)
+	var join struct {
+		GameID     string `json:"gameID"`
+		Username   string `json:"username"`
+		Name       string `json:"name"`
+		Passphrase string `json:"passphrase"`
+	}
+	err := readBodyJSON(request, &join)
+	httpBadRequestIf(response, request, err)
+	logf(request, "Join request: %v to join %v", join.Username, join.GameID)
+
+	conn := contextRedisConn(request.Context())
+	current := requestCurrentPlayer(response, request)
+	joinRequest, err := auth.RequestJoin(join.GameID, join.Username, join.Name, join.Passphrase, current, conn)
+	if err != nil {
+		logf(request, "Join request response: %v", err)
+	}
+	if errors.Is(err, auth.ErrTooManyAttempts) {
+		httpTooManyRequests(response, request, "Too many login attempts, try again later")
+	} else if errors.Is(err, game.ErrNotFound) {
+		httpForbidden(response, request, "Unable to request to join that game")
+	} else if errors.Is(err, auth.ErrNotAuthorized) {
+		httpForbidden(response, request, "Unable to request to join that game")
+	} else if errors.Is(err, auth.ErrAlreadyJoined) {
+		httpBadRequest(response, request, "You are already in that game")
+	} else if errors.Is(err, auth.ErrUsernameTaken) {
+		httpBadRequest(response, request, "That username is taken; log in to request with it")
+	} else if errors.Is(err, auth.ErrInvalidName) {
+		httpBadRequest(response, request, "name: invalid")
+	} else if errors.Is(err, game.ErrTooManyJoinRequests) {
+		httpForbidden(response, request, "That game has too many join requests")
+	}
+	httpInternalErrorIf(response, request, err)
+
+	err = writeBodyJSON(response, joinRequestResponse{
+		ID:     joinRequest.ID,
+		Token:  joinRequest.Token,
+		Status: joinRequest.Status,
+	})
+	httpInternalErrorIf(response, request, err)
+	httpSuccess(response, request, "Join request ", joinRequest.ID, " for ", join.GameID)
+}
+
+// POST /auth/join-status { id, token, persist } -> { status } or { status, login response }
+var _ = authRouter.HandleFunc("/join-status", handleJoinStatus).Methods("POST")
+
+func handleJoinStatus(response Response, request *Request) {
+	logRequest(request)
+	var check struct {
+		ID      string `json:"id"`
+		Token   string `json:"token"`
+		Persist bool   `json:"persist"`
+	}
+	err := readBodyJSON(request, &check)
+	httpBadRequestIf(response, request, err)
+
+	conn := contextRedisConn(request.Context())
+	joinRequest, gameInfo, plr, err := auth.CheckJoinRequest(check.ID, check.Token, conn)
+	if errors.Is(err, game.ErrJoinRequestNotFound) {
+		httpNotFound(response, request, "Join request not found")
+	}
+	httpInternalErrorIf(response, request, err)
+	if joinRequest.Status != game.JoinStatusApproved {
+		err = writeBodyJSON(response, map[string]string{"status": joinRequest.Status})
+		httpInternalErrorIf(response, request, err)
+		httpSuccess(response, request, "Join request ", joinRequest.ID, " is ", joinRequest.Status)
+		return
+	}
+
+	if requireSecondFactor(response, request, plr, gameInfo.ID, "", check.Persist, conn) {
+		// The login challenge finishes logging in from here
+		if err = game.RemoveJoinRequest(joinRequest.ID, conn); err != nil {
+			logf(request, "Error removing join request %v: %v", joinRequest.ID, err)
+		}
+		return
+	}
+	session, err := session.New(gameInfo.ID, plr, check.Persist, requestUserAgent(request), conn)
+	httpInternalErrorIf(response, request, err)
+	logf(request, "Created session %v for %v", session.ID, plr.ID)
+	err = game.RemoveJoinRequest(joinRequest.ID, conn)
+	httpInternalErrorIf(response, request, err)
+
+	err = writeBodyJSON(response, struct {
+		Status string `json:"status"`
+		loginResponse
+	}{
+		Status: joinRequest.Status,
+		loginResponse: loginResponse{
+			Player:   plr,
+			GameInfo: gameInfo,
+			Session:  string(session.ID),
+		},
+	})
+	httpInternalErrorIf(response, request, err)
+	httpSuccess(response, request,
+		session.Type(), " ", session.ID, " for ", session.PlayerID,
+		" in ", gameInfo.ID,
+	)
+}
+
+var _ = gameRouter.HandleFunc("/join-requests", handleGetJoinRequests).Methods("GET")
+
+// GET /join-requests -> [joinRequest]
+func handleGetJoinRequests(response Response, request *Request) {
+	logRequest(request)
+	sess, conn, err := requestSession(request)
+	httpUnauthorizedIf(response, request, err)
+	requirePermission(response, request, sess, conn, game.PermissionManagePlayers)
+
+	requests, err := game.GetJoinRequests(sess.GameID, conn)
+	httpInternalErrorIf(response, request, err)
+
+	err = writeBodyJSON(response, requests)
+	httpInternalErrorIf(response, request, err)
+	httpSuccess(response, request, len(requests), " join requests")
+}
+
+type answerJoinRequest struct {
+	ID      string `json:"id"`
+	Approve bool   `json:"approve"`
+}
+
+var _ = gameRouter.HandleFunc("/answer-join-request", handleAnswerJoinRequest).Methods("POST")
+
+// POST /answer-join-request { id, approve } -> OK
+func handleAnswerJoinRequest(response Response, request *Request) {
+	logRequest(request)
+	sess, conn, err := requestSession(request)
+	httpUnauthorizedIf(response, request, err)
+	requirePermission(response, request, sess, conn, game.PermissionManagePlayers)
+
+	var answer answerJoinRequest
+	err = readBodyJSON(request, &answer)
+	httpBadRequestIf(response, request, err)
+
+	logf(request, "%v answers join request %v: approve = %v",
+		sess.PlayerInfo(), answer.ID, answer.Approve,
+	)
+	joinRequest, err := auth.AnswerJoinRequest(sess.GameID, answer.ID, answer.Approve, conn)
+	if errors.Is(err, game.ErrJoinRequestNotFound) {
+		httpNotFound(response, request, "Join request not found")
+	} else if errors.Is(err, game.ErrJoinRequestAnswered) {
+		httpBadRequest(response, request, "That request was already answered")
+	} else if errors.Is(err, auth.ErrNotAuthorized) {
+		httpForbidden(response, request, "That player is banned from this game")
+	} else if errors.Is(err, auth.ErrUsernameTaken) {
+		httpBadRequest(response, request, "That username has since been taken")
+	}
+	httpInternalErrorIf(response, request, err)
+	httpSuccess(response, request,
+		"Join request ", joinRequest.ID, " from ", joinRequest.Username, " ", joinRequest.Status,
+	)
+}
+
+type allowJoinRequestsRequest struct {
+	Allowed bool `json:"allowed"`
+}
+
+var _ = gameRouter.HandleFunc("/allow-join-requests", handleAllowJoinRequests).Methods("POST")
+
+// POST /allow-join-requests { allowed } -> OK
+func handleAllowJoinRequests(response Response, request *Request) {
+	logRequest(request)
+	sess, conn, err := requestSession(request)
+	httpUnauthorizedIf(response, request, err)
+	requirePermission(response, request, sess, conn, game.PermissionManagePlayers)
+
+	var allow allowJoinRequestsRequest
+	err = readBodyJSON(request, &allow)
+	httpBadRequestIf(response, request, err)
+
+	logf(request, "%v sets join requests allowed = %v", sess.PlayerInfo(), allow.Allowed)
+	err = game.SetAllowsJoinRequests(sess.GameID, allow.Allowed, conn)
+	httpInternalErrorIf(response, request, err)
+	httpSuccess(response, request, "Join requests allowed = ", allow.Allowed)
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/base64"
 	"github.com/gomodule/redigo/redis"
 	"net/http"
+	"sr"
 	"sr/config"
 	redisUtil "sr/redis"
 	"strings"
@@ -53,8 +54,9 @@ func handleCoffee(response Response, request *Request) {
 }
 
 type healthCheckResponse struct {
-	Games    int `json:"games"`
-	Sessions int `json:"sessions"`
+	Games    int         `json:"games"`
+	Sessions int         `json:"sessions"`
+	Rolls    sr.Fairness `json:"rolls"`
 }
 
 var _ = restRouter.HandleFunc("/health-check", handleHealthCheck).Methods("GET")
@@ -106,10 +108,12 @@ func handleHealthCheck(response Response, request *Request) {
 	resp := healthCheckResponse{
 		Games:    gameCount,
 		Sessions: sessionCount,
+		Rolls:    sr.RollFairness(),
 	}
 	err = writeBodyJSON(response, &resp)
 	httpInternalErrorIf(response, request, err)
 	httpSuccess(response, request,
-		gameCount, " games ", sessionCount, " sessions",
+		gameCount, " games ", sessionCount, " sessions ",
+		"rolls alert = ", resp.Rolls.Alert,
 	)
 }
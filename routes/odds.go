@@ -0,0 +1,52 @@
+package routes
+
+import (
+	"errors"
+	"sr"
+	"sr/config"
+	"strconv"
+)
+
+var _ = restRouter.HandleFunc("/roll/odds", handleRollOdds).Methods("GET")
+
+// formInt parses an optional integer query parameter.
+func formInt(request *Request, name string) (int, error) {
+	value := request.FormValue(name)
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(value)
+}
+
+// GET /roll/odds?count&edge&secondChance&glitchy&limit -> { hits, atLeast, expectedHits, glitch, criticalGlitch }
+func handleRollOdds(response Response, request *Request) {
+	logRequest(request)
+
+	count, err := formInt(request, "count")
+	httpBadRequestIf(response, request, err)
+	glitchy, err := formInt(request, "glitchy")
+	httpBadRequestIf(response, request, err)
+	limit, err := formInt(request, "limit")
+	httpBadRequestIf(response, request, err)
+	edge := request.FormValue("edge") == "true"
+	secondChance := request.FormValue("secondChance") == "true"
+
+	if count < 1 {
+		httpBadRequest(response, request, "Invalid roll count")
+	}
+	if count > config.MaxSingleRoll {
+		httpBadRequest(response, request, "Roll count too high")
+	}
+
+	odds, err := sr.RollOdds(count, edge, secondChance, glitchy, limit)
+	if errors.Is(err, sr.ErrInvalidOdds) {
+		httpBadRequest(response, request, "Invalid roll")
+	}
+	httpInternalErrorIf(response, request, err)
+
+	err = writeBodyJSON(response, odds)
+	httpInternalErrorIf(response, request, err)
+	httpSuccess(response, request,
+		"Odds of ", count, " dice: ", odds.ExpectedHits, " expected hits",
+	)
+}
@@ -0,0 +1,151 @@
+package routes
+
+import (
+	"errors"
+	"sr/auth"
+	"sr/game"
+	"sr/oidc"
+	"sr/player"
+	"sr/session"
+)
+
+// POST /auth/oidc/begin { gameID, persist } -> { url, binding }
+// The client keeps the binding and sends it to /auth/oidc/finish.
+var _ = authRouter.HandleFunc("/oidc/begin", handleBeginOIDC).Methods("POST")
+
+func handleBeginOIDC(response Response, request *Request) {
+	logRequest(request)
+	if !oidc.Enabled() {
+		httpNotFound(response, request, "OIDC login is not enabled")
+	}
+	var begin struct {
+		GameID  string `json:"gameID"`
+		Persist bool   `json:"persist"`
+	}
+	err := readBodyJSON(request, &begin)
+	httpBadRequestIf(response, request, err)
+	logf(request, "OIDC login request to %v", begin.GameID)
+
+	conn := contextRedisConn(request.Context())
+	authURL, binding, err := auth.BeginOIDCLogin(request.Context(), begin.GameID, begin.Persist, conn)
+	httpInternalErrorIf(response, request, err)
+
+	err = writeBodyJSON(response, map[string]string{"url": authURL, "binding": binding})
+	httpInternalErrorIf(response, request, err)
+	httpSuccess(response, request, "OIDC login started for ", begin.GameID)
+}
+
+type oidcFinishResponse struct {
+	Player   *player.Player `json:"player"`
+	GameInfo *game.Info     `json:"game,omitempty"`
+	Session  string         `json:"session,omitempty"`
+	Linked   bool           `json:"linked"`
+}
+
+// POST /auth/oidc/finish { state, binding, code } -> { login response } or { player, linked }
+var _ = authRouter.HandleFunc("/oidc/finish", handleFinishOIDC).Methods("POST")
+
+func handleFinishOIDC(response Response, request *Request) {
+	logRequest(request)
+	if !oidc.Enabled() {
+		httpNotFound(response, request, "OIDC login is not enabled")
+	}
+	var finish struct {
+		State   string `json:"state"`
+		Binding string `json:"binding"`
+		Code    string `json:"code"`
+	}
+	err := readBodyJSON(request, &finish)
+	httpBadRequestIf(response, request, err)
+
+	conn := contextRedisConn(request.Context())
+	login, err := auth.FinishOIDC(request.Context(), finish.State, finish.Binding, finish.Code, conn)
+	if err != nil {
+		logf(request, "OIDC response: %v", err)
+	}
+	if errors.Is(err, auth.ErrOIDCStateNotFound) {
+		httpBadRequest(response, request, "That login has expired")
+	} else if errors.Is(err, auth.ErrOIDCWrongClient) ||
+		errors.Is(err, oidc.ErrInvalidToken) {
+		httpForbidden(response, request, "Unable to verify that login")
+	} else if errors.Is(err, auth.ErrIdentityLinked) {
+		httpForbidden(response, request, "That account is linked to another player")
+	} else if errors.Is(err, auth.ErrNotAuthorized) ||
+		errors.Is(err, game.ErrNotFound) {
+		httpForbidden(response, request, "That account cannot log in to that game")
+	}
+	httpInternalErrorIf(response, request, err)
+
+	if login.GameInfo == nil {
+		err = writeBodyJSON(response, oidcFinishResponse{Player: login.Player, Linked: true})
+		httpInternalErrorIf(response, request, err)
+		httpSuccess(response, request, "Linked OIDC identity to ", login.Player.ID)
+		return
+	}
+
+	if requireSecondFactor(response, request, login.Player, login.GameInfo.ID, "", login.Persist, conn) {
+		return
+	}
+	sess, err := session.New(login.GameInfo.ID, login.Player, login.Persist, requestUserAgent(request), conn)
+	httpInternalErrorIf(response, request, err)
+	logf(request, "Created session %v for %v", sess.ID, login.Player.ID)
+
+	err = writeBodyJSON(response, oidcFinishResponse{
+		Player:   login.Player,
+		GameInfo: login.GameInfo,
+		Session:  string(sess.ID),
+	})
+	httpInternalErrorIf(response, request, err)
+	httpSuccess(response, request,
+		sess.Type(), " ", sess.ID, " for ", sess.PlayerID,
+		" in ", login.GameInfo.ID, " via OIDC",
+	)
+}
+
+var _ = playerRouter.HandleFunc("/oidc/link", handleLinkOIDC).Methods("POST")
+
+// POST /player/oidc/link { passphrase, code } -> { url, binding }
+func handleLinkOIDC(response Response, request *Request) {
+	logRequest(request)
+	if !oidc.Enabled() {
+		httpNotFound(response, request, "OIDC login is not enabled")
+	}
+	sess, conn, err := requestSession(request)
+	httpUnauthorizedIf(response, request, err)
+	requirePlayerSession(response, request, sess)
+
+	var link struct {
+		Passphrase string `json:"passphrase"`
+		Code       string `json:"code"`
+	}
+	err = readBodyJSON(request, &link)
+	httpBadRequestIf(response, request, err)
+
+	plr, err := sess.GetPlayer(conn)
+	httpInternalErrorIf(response, request, err)
+	authURL, binding, err := auth.BeginOIDCLink(request.Context(), plr, link.Passphrase, link.Code, conn)
+	if errors.Is(err, auth.ErrTooManyAttempts) {
+		httpTooManyRequests(response, request, "Too many attempts, try again later")
+	} else if errors.Is(err, auth.ErrNotAuthorized) {
+		httpForbidden(response, request, "Current passphrase or code is wrong")
+	}
+	httpInternalErrorIf(response, request, err)
+
+	err = writeBodyJSON(response, map[string]string{"url": authURL, "binding": binding})
+	httpInternalErrorIf(response, request, err)
+	httpSuccess(response, request, "OIDC link started for ", sess.PlayerID)
+}
+
+var _ = playerRouter.HandleFunc("/oidc/unlink", handleUnlinkOIDC).Methods("POST")
+
+// POST /player/oidc/unlink -> OK
+func handleUnlinkOIDC(response Response, request *Request) {
+	logRequest(request)
+	sess, conn, err := requestSession(request)
+	httpUnauthorizedIf(response, request, err)
+	requirePlayerSession(response, request, sess)
+
+	err = auth.UnlinkOIDC(sess.PlayerID, conn)
+	httpInternalErrorIf(response, request, err)
+	httpSuccess(response, request, "Unlinked OIDC identity from ", sess.PlayerID)
+}
@@ -0,0 +1,135 @@
+package routes
+
+import (
+	"errors"
+	"sr/game"
+	"sr/id"
+	"sr/player"
+	"sr/session"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// requestRole retrieves the role of the session's player in its game.
+// Players who are no longer in the game are forbidden. Spectator sessions are
+// RoleSpectator, and are forbidden if the game no longer allows spectators.
+func requestRole(response Response, request *Request, sess *session.Session, conn redis.Conn) game.Role {
+	if sess.Spectator {
+		allowed, err := game.AllowsSpectators(sess.GameID, conn)
+		httpInternalErrorIf(response, request, err)
+		if !allowed {
+			httpForbidden(response, request, "This game does not allow spectators.")
+		}
+		return game.RoleSpectator
+	}
+	role, err := game.GetRole(sess.GameID, sess.PlayerID, conn)
+	if errors.Is(err, game.ErrNotInGame) {
+		httpForbidden(response, request, "You are not in this game.")
+	}
+	httpInternalErrorIf(response, request, err)
+	return role
+}
+
+// requirePermission retrieves the role of the session's player in its game,
+// and forbids the request if the role does not have the permission. Posting,
+// chatting, and changing events mark the player active.
+func requirePermission(response Response, request *Request, sess *session.Session, conn redis.Conn, permission game.Permission) game.Role {
+	role := requestRole(response, request, sess, conn)
+	if !role.Can(permission) {
+		logf(request, "%v is %v, lacks permission %v", sess.PlayerInfo(), role, permission)
+		httpForbidden(response, request, "You may not do that in this game.")
+	}
+	if permission == game.PermissionPost {
+		markActive(request, sess, conn)
+	}
+	return role
+}
+
+// requestViewer retrieves the player of the session for checking which events
+// it can see. Spectators get a stand-in player who is not in the game, so they
+// only see events shared with the game.
+func requestViewer(response Response, request *Request, sess *session.Session, conn redis.Conn) *player.Player {
+	if sess.Spectator {
+		return &player.Player{ID: sess.PlayerID, Name: "Spectator"}
+	}
+	plr, err := sess.GetPlayer(conn)
+	httpInternalErrorIf(response, request, err)
+	return plr
+}
+
+// requirePlayerSession forbids spectator sessions from player-only routes.
+func requirePlayerSession(response Response, request *Request, sess *session.Session) {
+	if sess.Spectator {
+		httpForbidden(response, request, "Spectators may not do that.")
+	}
+}
+
+type setRoleRequest struct {
+	PlayerID id.UID `json:"playerID"`
+	Role     string `json:"role"`
+}
+
+var _ = gameRouter.HandleFunc("/set-role", handleSetRole).Methods("POST")
+
+// POST /set-role { playerID, role } -> OK
+func handleSetRole(response Response, request *Request) {
+	logRequest(request)
+	sess, conn, err := requestSession(request)
+	httpUnauthorizedIf(response, request, err)
+	role := requirePermission(response, request, sess, conn, game.PermissionManagePlayers)
+
+	var setRole setRoleRequest
+	err = readBodyJSON(request, &setRole)
+	httpBadRequestIf(response, request, err)
+	if !game.IsRole(setRole.Role) {
+		httpBadRequest(response, request, "role: invalid")
+	}
+	newRole := game.Role(setRole.Role)
+	if newRole == game.RoleOwner {
+		httpBadRequest(response, request, "role: games have one owner")
+	}
+
+	logf(request, "%v sets role of %v to %v", sess.PlayerInfo(), setRole.PlayerID, newRole)
+	oldRole, err := game.GetRole(sess.GameID, setRole.PlayerID, conn)
+	if errors.Is(err, game.ErrNotInGame) {
+		httpNotFound(response, request, "Player not found")
+	}
+	httpInternalErrorIf(response, request, err)
+	if oldRole == game.RoleOwner {
+		httpForbidden(response, request, "You may not change the owner's role.")
+	}
+	if (oldRole == game.RoleGM || newRole == game.RoleGM) && !role.Can(game.PermissionAssignGMs) {
+		httpForbidden(response, request, "You may not change who is a GM.")
+	}
+	if oldRole == newRole {
+		httpSuccess(response, request, "(Idempotent, no changes made)")
+		return
+	}
+
+	err = game.SetRole(sess.GameID, setRole.PlayerID, newRole, conn)
+	httpInternalErrorIf(response, request, err)
+	httpSuccess(response, request, setRole.PlayerID, " is now ", newRole)
+}
+
+type allowSpectatorsRequest struct {
+	Allowed bool `json:"allowed"`
+}
+
+var _ = gameRouter.HandleFunc("/allow-spectators", handleAllowSpectators).Methods("POST")
+
+// POST /allow-spectators { allowed } -> OK
+func handleAllowSpectators(response Response, request *Request) {
+	logRequest(request)
+	sess, conn, err := requestSession(request)
+	httpUnauthorizedIf(response, request, err)
+	requirePermission(response, request, sess, conn, game.PermissionManagePlayers)
+
+	var allow allowSpectatorsRequest
+	err = readBodyJSON(request, &allow)
+	httpBadRequestIf(response, request, err)
+
+	logf(request, "%v sets spectators allowed = %v", sess.PlayerInfo(), allow.Allowed)
+	err = game.SetAllowsSpectators(sess.GameID, allow.Allowed, conn)
+	httpInternalErrorIf(response, request, err)
+	httpSuccess(response, request, "Spectators allowed = ", allow.Allowed)
+}
@@ -1,10 +1,14 @@
 package routes
 
 import (
+	"errors"
 	"fmt"
+	"sort"
+	"sr/auth"
+	"sr/event"
 	"sr/game"
 	"sr/player"
-	"sr/update"
+	"sr/session"
 	"strings"
 )
 
@@ -20,6 +24,7 @@ func handleUpdatePlayer(response Response, request *Request) {
 	logRequest(request)
 	sess, conn, err := requestSession(request)
 	httpUnauthorizedIf(response, request, err)
+	requirePlayerSession(response, request, sess)
 
 	var updateRequest playerUpdateRequest
 	err = readBodyJSON(request, &updateRequest)
@@ -54,26 +59,25 @@ func handleUpdatePlayer(response Response, request *Request) {
 			}
 			internalDiff["hue"] = int(hue)
 			externalDiff["hue"] = int(hue)
+		case "status":
+			status, ok := value.(string)
+			if !ok {
+				httpBadRequest(response, request, "status: expected string")
+			}
+			status = strings.TrimSpace(status)
+			if !player.ValidStatus(status) {
+				httpBadRequest(response, request, "status: invalid")
+			}
+			externalDiff["status"] = status
+			internalDiff["status"] = status
 		case "onlineMode":
 			var mode player.OnlineMode
 			modeFloat, ok := value.(float64)
 			modeInt := int(modeFloat)
-			if !ok || modeInt < player.OnlineModeAuto || modeInt > player.OnlineModeOffline {
-				httpBadRequest(response, request, "mode: expected auto, online, offline")
+			if !ok || modeInt < player.OnlineModeAuto || modeInt > player.OnlineModeAway {
+				httpBadRequest(response, request, "mode: expected auto, online, offline, away")
 			}
 			mode = modeInt
-
-			// Determine if online mode changes player online status
-			plr, err := player.GetByID(string(sess.PlayerID), conn)
-			httpInternalErrorIf(response, request, err)
-			previouslyOnline := plr.IsOnline()
-			// Change the variable `plr` to see if the change affects IsOnline()
-			plr.OnlineMode = mode
-			updatedOnline := plr.IsOnline()
-
-			if previouslyOnline != updatedOnline {
-				externalDiff["online"] = updatedOnline
-			}
 			internalDiff["onlineMode"] = mode
 		default:
 			httpBadRequest(response, request,
@@ -82,13 +86,13 @@ func handleUpdatePlayer(response Response, request *Request) {
 		}
 	}
 	logf(request, "Created updates %#v and %#v", externalDiff, internalDiff)
-	externalUpdate := update.ForPlayerDiff(sess.PlayerID, externalDiff)
-	internalUpdate := update.ForPlayerDiff(sess.PlayerID, internalDiff)
-	if externalUpdate.IsEmpty() && internalUpdate.IsEmpty() {
+	if len(externalDiff) == 0 && len(internalDiff) == 0 {
 		httpBadRequest(response, request, "No update made?")
 	}
 
-	err = game.UpdatePlayer(sess.GameID, sess.PlayerID, externalUpdate, internalUpdate, conn)
+	plr, err := sess.GetPlayer(conn)
+	httpInternalErrorIf(response, request, err)
+	err = game.UpdatePlayer(plr, externalDiff, internalDiff, conn)
 	httpInternalErrorIf(response, request, err)
 	err = writeBodyJSON(response, internalDiff)
 	httpInternalErrorIf(response, request, err)
@@ -96,3 +100,235 @@ func handleUpdatePlayer(response Response, request *Request) {
 		"Player ", sess.PlayerID, " update ", internalDiff,
 	)
 }
+
+var _ = playerRouter.HandleFunc("/bookmarks", handleGetBookmarks).Methods("GET")
+
+// GET /player/bookmarks -> [event]
+func handleGetBookmarks(response Response, request *Request) {
+	logRequest(request)
+	sess, conn, err := requestSession(request)
+	httpUnauthorizedIf(response, request, err)
+	requirePlayerSession(response, request, sess)
+
+	plr, err := sess.GetPlayer(conn)
+	httpInternalErrorIf(response, request, err)
+	bookmarks, err := game.GetBookmarks(sess.GameID, sess.PlayerID, conn)
+	httpInternalErrorIf(response, request, err)
+
+	events := make([]event.Event, 0, len(bookmarks))
+	for _, eventID := range bookmarks {
+		eventText, err := event.GetByID(sess.GameID, eventID, conn)
+		if err != nil {
+			logf(request, "Skipping bookmark %v: %v", eventID, err)
+			continue
+		}
+		evt, err := event.Parse([]byte(eventText))
+		httpInternalErrorIf(response, request, err)
+		if !game.PlayerCanSeeEvent(plr, evt) {
+			continue
+		}
+		events = append(events, evt)
+	}
+
+	err = writeBodyJSON(response, events)
+	httpInternalErrorIf(response, request, err)
+	httpSuccess(response, request,
+		len(events), " of ", len(bookmarks), " bookmarks for ", sess.PlayerInfo(),
+	)
+}
+
+type bookmarkRequest struct {
+	ID         int64 `json:"id"`
+	Bookmarked bool  `json:"bookmarked"`
+}
+
+var _ = playerRouter.HandleFunc("/bookmarks", handleSetBookmark).Methods("POST")
+
+// POST /player/bookmarks { id, bookmarked } -> OK
+func handleSetBookmark(response Response, request *Request) {
+	logRequest(request)
+	sess, conn, err := requestSession(request)
+	httpUnauthorizedIf(response, request, err)
+	requirePlayerSession(response, request, sess)
+
+	var bookmark bookmarkRequest
+	err = readBodyJSON(request, &bookmark)
+	httpBadRequestIf(response, request, err)
+
+	logf(request, "%v sets bookmarked %v on %v",
+		sess.PlayerInfo(), bookmark.Bookmarked, bookmark.ID,
+	)
+	if bookmark.Bookmarked {
+		requestVisibleEvent(response, request, sess, bookmark.ID, conn)
+	}
+
+	changed, err := game.SetBookmarked(
+		sess.GameID, sess.PlayerID, bookmark.ID, bookmark.Bookmarked, conn,
+	)
+	httpInternalErrorIf(response, request, err)
+	if !changed {
+		httpSuccess(response, request, "(Idempotent, no changes made)")
+		return
+	}
+	httpSuccess(response, request,
+		"Event ", bookmark.ID, " bookmarked = ", bookmark.Bookmarked,
+	)
+}
+
+type passphraseRequest struct {
+	Current    string `json:"current"`
+	Passphrase string `json:"passphrase"`
+}
+
+var _ = playerRouter.HandleFunc("/passphrase", handleGetPassphrase).Methods("GET")
+
+// GET /player/passphrase -> { set }
+func handleGetPassphrase(response Response, request *Request) {
+	logRequest(request)
+	sess, conn, err := requestSession(request)
+	httpUnauthorizedIf(response, request, err)
+	requirePlayerSession(response, request, sess)
+
+	set, err := player.HasPassphrase(sess.PlayerID, conn)
+	httpInternalErrorIf(response, request, err)
+	err = writeBodyJSON(response, map[string]bool{"set": set})
+	httpInternalErrorIf(response, request, err)
+	httpSuccess(response, request, "Passphrase set = ", set)
+}
+
+var _ = playerRouter.HandleFunc("/passphrase", handleSetPassphrase).Methods("POST")
+
+// POST /player/passphrase { current, passphrase } -> OK
+func handleSetPassphrase(response Response, request *Request) {
+	logRequest(request)
+	sess, conn, err := requestSession(request)
+	httpUnauthorizedIf(response, request, err)
+	requirePlayerSession(response, request, sess)
+
+	var change passphraseRequest
+	err = readBodyJSON(request, &change)
+	httpBadRequestIf(response, request, err)
+	if change.Passphrase != "" && !player.ValidPassphrase(change.Passphrase) {
+		httpBadRequest(response, request, "passphrase: invalid")
+	}
+
+	plr, err := sess.GetPlayer(conn)
+	httpInternalErrorIf(response, request, err)
+	logf(request, "%v changes passphrase", sess.PlayerInfo())
+	err = auth.ChangePassphrase(plr, change.Current, change.Passphrase, conn)
+	if errors.Is(err, auth.ErrTooManyAttempts) {
+		httpTooManyRequests(response, request, "Too many attempts, try again later")
+	} else if errors.Is(err, auth.ErrNotAuthorized) {
+		httpForbidden(response, request, "Current passphrase is wrong")
+	}
+	httpInternalErrorIf(response, request, err)
+	if change.Passphrase == "" {
+		httpSuccess(response, request, "Removed passphrase for ", sess.PlayerID)
+		return
+	}
+	httpSuccess(response, request, "Set passphrase for ", sess.PlayerID)
+}
+
+type playerGame struct {
+	ID      string    `json:"id"`
+	Role    game.Role `json:"role"`
+	Current bool      `json:"current"`
+}
+
+var _ = playerRouter.HandleFunc("/games", handleGetPlayerGames).Methods("GET")
+
+// GET /player/games -> [{ id, role, current }]
+func handleGetPlayerGames(response Response, request *Request) {
+	logRequest(request)
+	sess, conn, err := requestSession(request)
+	httpUnauthorizedIf(response, request, err)
+	requirePlayerSession(response, request, sess)
+
+	gameIDs, err := game.GetPlayerGames(sess.PlayerID, conn)
+	httpInternalErrorIf(response, request, err)
+	sort.Strings(gameIDs)
+	games := make([]playerGame, 0, len(gameIDs))
+	for _, gameID := range gameIDs {
+		role, err := game.GetRole(gameID, sess.PlayerID, conn)
+		if errors.Is(err, game.ErrNotInGame) {
+			continue
+		}
+		httpInternalErrorIf(response, request, err)
+		exists, err := game.Exists(gameID, conn)
+		httpInternalErrorIf(response, request, err)
+		if !exists {
+			continue
+		}
+		games = append(games, playerGame{
+			ID: gameID, Role: role, Current: gameID == sess.GameID,
+		})
+	}
+
+	err = writeBodyJSON(response, games)
+	httpInternalErrorIf(response, request, err)
+	httpSuccess(response, request, len(games), " games for ", sess.PlayerID)
+}
+
+type switchGameRequest struct {
+	GameID string `json:"gameID"`
+}
+
+var _ = playerRouter.HandleFunc("/switch-game", handleSwitchGame).Methods("POST")
+
+// POST /player/switch-game { gameID } -> { login response }
+func handleSwitchGame(response Response, request *Request) {
+	logRequest(request)
+	sess, conn, err := requestSession(request)
+	httpUnauthorizedIf(response, request, err)
+	requirePlayerSession(response, request, sess)
+
+	var switchGame switchGameRequest
+	err = readBodyJSON(request, &switchGame)
+	httpBadRequestIf(response, request, err)
+	logf(request, "%v switches to %v", sess.PlayerInfo(), switchGame.GameID)
+
+	gameInfo, plr, err := auth.SwitchGame(sess.PlayerID, switchGame.GameID, conn)
+	if errors.Is(err, game.ErrNotFound) || errors.Is(err, auth.ErrNotAuthorized) {
+		httpForbidden(response, request, "Unable to switch to that game")
+	}
+	httpInternalErrorIf(response, request, err)
+
+	newSess, err := session.New(gameInfo.ID, plr, sess.Persist, requestUserAgent(request), conn)
+	httpInternalErrorIf(response, request, err)
+
+	err = writeBodyJSON(response, loginResponse{
+		Player:   plr,
+		GameInfo: gameInfo,
+		Session:  string(newSess.ID),
+	})
+	httpInternalErrorIf(response, request, err)
+	httpSuccess(response, request,
+		newSess.Type(), " ", newSess.ID, " for ", newSess.PlayerID,
+		" in ", gameInfo.ID, " from ", sess.GameID,
+	)
+}
+
+type activityRequest struct {
+	Activity string `json:"activity"`
+}
+
+var _ = playerRouter.HandleFunc("/activity", handleSetActivity).Methods("POST")
+
+// POST /player/activity { activity } -> {}
+func handleSetActivity(response Response, request *Request) {
+	logRequest(request)
+	sess, conn, err := requestSession(request)
+	httpUnauthorizedIf(response, request, err)
+	requirePlayerSession(response, request, sess)
+
+	var activity activityRequest
+	err = readBodyJSON(request, &activity)
+	httpBadRequestIf(response, request, err)
+	if !game.ValidActivity(activity.Activity) {
+		httpBadRequest(response, request, "activity: expected typing, rolling, or empty")
+	}
+
+	err = game.SetActivity(sess.GameID, sess.PlayerID, activity.Activity, conn)
+	httpInternalErrorIf(response, request, err)
+	httpSuccess(response, request, sess.PlayerID, " activity ", activity.Activity)
+}
@@ -0,0 +1,142 @@
+package routes
+
+import (
+	"errors"
+	"sr/event"
+	"sr/game"
+	"sr/session"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// requestVisibleEvent finds an event the session's player is allowed to see.
+func requestVisibleEvent(response Response, request *Request, sess *session.Session, eventID int64, conn redis.Conn) event.Event {
+	eventText, err := event.GetByID(sess.GameID, eventID, conn)
+	httpNotFoundIf(response, request, err)
+	evt, err := event.Parse([]byte(eventText))
+	httpInternalErrorIf(response, request, err)
+
+	plr := requestViewer(response, request, sess, conn)
+	if !game.PlayerCanSeeEvent(plr, evt) {
+		httpNotFound(response, request, "Event not found")
+	}
+	return evt
+}
+
+type reactRequest struct {
+	ID      int64  `json:"id"`
+	Emoji   string `json:"emoji"`
+	Reacted bool   `json:"reacted"`
+}
+
+var _ = gameRouter.HandleFunc("/react", handleReact).Methods("POST")
+
+// POST /react { id, emoji, reacted } -> OK
+func handleReact(response Response, request *Request) {
+	logRequest(request)
+	sess, conn, err := requestSession(request)
+	httpUnauthorizedIf(response, request, err)
+	requirePermission(response, request, sess, conn, game.PermissionPost)
+
+	var react reactRequest
+	err = readBodyJSON(request, &react)
+	httpBadRequestIf(response, request, err)
+	if !event.ValidReaction(react.Emoji) {
+		httpBadRequest(response, request, "emoji: invalid")
+	}
+
+	logf(request, "%v reacts %v %v to %v",
+		sess.PlayerInfo(), react.Emoji, react.Reacted, react.ID,
+	)
+	requestVisibleEvent(response, request, sess, react.ID, conn)
+
+	err = game.ModifyEvent(sess.GameID, react.ID, func(evt event.Event) (map[string]interface{}, error) {
+		if !evt.SetReaction(react.Emoji, sess.PlayerID, react.Reacted) {
+			return nil, nil
+		}
+		return map[string]interface{}{"reactions": evt.GetReactions()}, nil
+	}, conn)
+	httpInternalErrorIf(response, request, err)
+	httpSuccess(response, request, "Reacted to ", react.ID)
+}
+
+type commentRequest struct {
+	ID   int64  `json:"id"`
+	Text string `json:"text"`
+}
+
+var _ = gameRouter.HandleFunc("/comment", handleComment).Methods("POST")
+
+// POST /comment { id, text } -> OK
+func handleComment(response Response, request *Request) {
+	logRequest(request)
+	sess, conn, err := requestSession(request)
+	httpUnauthorizedIf(response, request, err)
+	requirePermission(response, request, sess, conn, game.PermissionPost)
+
+	var commentReq commentRequest
+	err = readBodyJSON(request, &commentReq)
+	httpBadRequestIf(response, request, err)
+	text, ok := event.ValidCommentText(commentReq.Text)
+	if !ok {
+		httpBadRequest(response, request, "text: invalid")
+	}
+
+	logf(request, "%v comments on %v", sess.PlayerInfo(), commentReq.ID)
+	requestVisibleEvent(response, request, sess, commentReq.ID, conn)
+	plr, err := sess.GetPlayer(conn)
+	httpInternalErrorIf(response, request, err)
+
+	comment := event.ForComment(plr, text)
+	err = game.ModifyEvent(sess.GameID, commentReq.ID, func(evt event.Event) (map[string]interface{}, error) {
+		if err := evt.AddComment(comment); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"comments": evt.GetComments()}, nil
+	}, conn)
+	if errors.Is(err, event.ErrTooManyComments) {
+		httpBadRequest(response, request, "Too many comments on this event")
+	}
+	httpInternalErrorIf(response, request, err)
+	httpSuccess(response, request,
+		"Comment ", comment.ID, " on ", commentReq.ID,
+	)
+}
+
+type deleteCommentRequest struct {
+	ID        int64 `json:"id"`
+	CommentID int64 `json:"commentID"`
+}
+
+var _ = gameRouter.HandleFunc("/delete-comment", handleDeleteComment).Methods("POST")
+
+// POST /delete-comment { id, commentID } -> OK
+func handleDeleteComment(response Response, request *Request) {
+	logRequest(request)
+	sess, conn, err := requestSession(request)
+	httpUnauthorizedIf(response, request, err)
+	requirePermission(response, request, sess, conn, game.PermissionPost)
+
+	var deleteReq deleteCommentRequest
+	err = readBodyJSON(request, &deleteReq)
+	httpBadRequestIf(response, request, err)
+
+	logf(request, "%v deletes comment %v on %v",
+		sess.PlayerInfo(), deleteReq.CommentID, deleteReq.ID,
+	)
+	requestVisibleEvent(response, request, sess, deleteReq.ID, conn)
+
+	err = game.ModifyEvent(sess.GameID, deleteReq.ID, func(evt event.Event) (map[string]interface{}, error) {
+		if err := evt.RemoveComment(deleteReq.CommentID, sess.PlayerID); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"comments": evt.GetComments()}, nil
+	}, conn)
+	if errors.Is(err, event.ErrCommentNotFound) {
+		httpNotFoundIf(response, request, err)
+	}
+	httpInternalErrorIf(response, request, err)
+	httpSuccess(response, request,
+		"Deleted comment ", deleteReq.CommentID, " on ", deleteReq.ID,
+	)
+}
@@ -0,0 +1,83 @@
+package routes
+
+import (
+	"errors"
+	"sr/event"
+	"sr/game"
+)
+
+var _ = gameRouter.HandleFunc("/scenes", handleScenes).Methods("GET")
+
+// GET /scenes -> [{ id, title, end?, events }]
+func handleScenes(response Response, request *Request) {
+	logRequest(request)
+	sess, conn, err := requestSession(request)
+	httpUnauthorizedIf(response, request, err)
+	requestRole(response, request, sess, conn)
+
+	scenes, err := game.GetScenes(sess.GameID, conn)
+	httpInternalErrorIf(response, request, err)
+
+	err = writeBodyJSON(response, scenes)
+	httpInternalErrorIf(response, request, err)
+	httpSuccess(response, request, len(scenes), " scenes in ", sess.GameID)
+}
+
+type startSceneRequest struct {
+	Title string `json:"title"`
+}
+
+var _ = gameRouter.HandleFunc("/start-scene", handleStartScene).Methods("POST")
+
+// POST /start-scene { title } -> { id }
+func handleStartScene(response Response, request *Request) {
+	logRequest(request)
+	sess, conn, err := requestSession(request)
+	httpUnauthorizedIf(response, request, err)
+	requirePermission(response, request, sess, conn, game.PermissionManageScenes)
+
+	var start startSceneRequest
+	err = readBodyJSON(request, &start)
+	httpBadRequestIf(response, request, err)
+	if !event.ValidSceneTitle(start.Title) {
+		httpBadRequest(response, request, "Invalid scene title")
+	}
+
+	plr, err := sess.GetPlayer(conn)
+	httpInternalErrorIf(response, request, err)
+
+	logf(request, "%v starts scene %q", sess.PlayerInfo(), start.Title)
+	evt, err := game.StartScene(sess.GameID, plr, start.Title, conn)
+	if errors.Is(err, game.ErrSceneActive) {
+		httpBadRequest(response, request, "A scene is already active")
+	}
+	httpInternalErrorIf(response, request, err)
+
+	err = writeBodyJSON(response, map[string]interface{}{"id": evt.GetID()})
+	httpInternalErrorIf(response, request, err)
+	httpSuccess(response, request, "Scene ", evt.GetID(), " started")
+}
+
+var _ = gameRouter.HandleFunc("/end-scene", handleEndScene).Methods("POST")
+
+// POST /end-scene -> { id }
+func handleEndScene(response Response, request *Request) {
+	logRequest(request)
+	sess, conn, err := requestSession(request)
+	httpUnauthorizedIf(response, request, err)
+	requirePermission(response, request, sess, conn, game.PermissionManageScenes)
+
+	plr, err := sess.GetPlayer(conn)
+	httpInternalErrorIf(response, request, err)
+
+	logf(request, "%v ends the active scene", sess.PlayerInfo())
+	evt, err := game.EndScene(sess.GameID, plr, conn)
+	if errors.Is(err, game.ErrNoActiveScene) {
+		httpBadRequest(response, request, "No scene is active")
+	}
+	httpInternalErrorIf(response, request, err)
+
+	err = writeBodyJSON(response, map[string]interface{}{"id": evt.GetID()})
+	httpInternalErrorIf(response, request, err)
+	httpSuccess(response, request, "Scene ", evt.Scene, " ended")
+}
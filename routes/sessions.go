@@ -0,0 +1,105 @@
+package routes
+
+import (
+	"sr/id"
+	"sr/session"
+)
+
+type sessionInfo struct {
+	ID        string `json:"id"`
+	GameID    string `json:"gameID"`
+	Persist   bool   `json:"persist"`
+	UserAgent string `json:"userAgent"`
+	Created   int64  `json:"created"`
+	LastSeen  int64  `json:"lastSeen"`
+	Current   bool   `json:"current"`
+}
+
+var _ = playerRouter.HandleFunc("/sessions", handleGetSessions).Methods("GET")
+
+// GET /player/sessions -> [sessionInfo]
+func handleGetSessions(response Response, request *Request) {
+	logRequest(request)
+	sess, conn, err := requestSession(request)
+	httpUnauthorizedIf(response, request, err)
+	requirePlayerSession(response, request, sess)
+
+	sessions, err := session.ListForPlayer(sess.PlayerID, conn)
+	httpInternalErrorIf(response, request, err)
+	infos := make([]sessionInfo, len(sessions))
+	for i, found := range sessions {
+		infos[i] = sessionInfo{
+			ID:        found.Handle(),
+			GameID:    found.GameID,
+			Persist:   found.Persist,
+			UserAgent: found.UserAgent,
+			Created:   found.Created,
+			LastSeen:  found.LastSeen,
+			Current:   found.ID == sess.ID,
+		}
+	}
+
+	err = writeBodyJSON(response, infos)
+	httpInternalErrorIf(response, request, err)
+	httpSuccess(response, request, len(infos), " sessions for ", sess.PlayerID)
+}
+
+type revokeSessionRequest struct {
+	ID string `json:"id"`
+}
+
+var _ = playerRouter.HandleFunc("/sessions/revoke", handleRevokeSession).Methods("POST")
+
+// POST /player/sessions/revoke { id } -> OK
+func handleRevokeSession(response Response, request *Request) {
+	logRequest(request)
+	sess, conn, err := requestSession(request)
+	httpUnauthorizedIf(response, request, err)
+	requirePlayerSession(response, request, sess)
+
+	var revoke revokeSessionRequest
+	err = readBodyJSON(request, &revoke)
+	httpBadRequestIf(response, request, err)
+
+	sessions, err := session.ListForPlayer(sess.PlayerID, conn)
+	httpInternalErrorIf(response, request, err)
+	for _, found := range sessions {
+		if found.Handle() != revoke.ID {
+			continue
+		}
+		err = found.Remove(conn)
+		httpInternalErrorIf(response, request, err)
+		httpSuccess(response, request, "Revoked session ", found.ID, " of ", sess.PlayerID)
+		return
+	}
+	httpNotFound(response, request, "Session not found")
+}
+
+type revokeAllSessionsRequest struct {
+	IncludeCurrent bool `json:"includeCurrent"`
+}
+
+var _ = playerRouter.HandleFunc("/sessions/revoke-all", handleRevokeAllSessions).Methods("POST")
+
+// POST /player/sessions/revoke-all { includeCurrent } -> { revoked }
+func handleRevokeAllSessions(response Response, request *Request) {
+	logRequest(request)
+	sess, conn, err := requestSession(request)
+	httpUnauthorizedIf(response, request, err)
+	requirePlayerSession(response, request, sess)
+
+	var revoke revokeAllSessionsRequest
+	err = readBodyJSON(request, &revoke)
+	httpBadRequestIf(response, request, err)
+
+	keep := sess.ID
+	if revoke.IncludeCurrent {
+		keep = id.UID("")
+	}
+	revoked, err := session.RemoveAllForPlayer(sess.PlayerID, keep, conn)
+	httpInternalErrorIf(response, request, err)
+
+	err = writeBodyJSON(response, map[string]int{"revoked": revoked})
+	httpInternalErrorIf(response, request, err)
+	httpSuccess(response, request, "Revoked ", revoked, " sessions of ", sess.PlayerID)
+}
@@ -0,0 +1,57 @@
+package routes
+
+import (
+	"sr/game"
+	"sr/id"
+)
+
+type statsSummary struct {
+	*game.Stats
+	HitRate           float64 `json:"hitRate"`
+	AverageInitiative float64 `json:"averageInitiative"`
+}
+
+func summarizeStats(stats *game.Stats) statsSummary {
+	return statsSummary{
+		Stats:             stats,
+		HitRate:           stats.HitRate(),
+		AverageInitiative: stats.AverageInitiative(),
+	}
+}
+
+type statsResponse struct {
+	Game       statsSummary            `json:"game"`
+	Players    map[id.UID]statsSummary `json:"players"`
+	Unluckiest id.UID                  `json:"unluckiest,omitempty"`
+}
+
+var _ = gameRouter.HandleFunc("/stats", handleStats).Methods("GET")
+
+// GET /stats -> { game: {stats}, players: { id: {stats} }, unluckiest: id }
+func handleStats(response Response, request *Request) {
+	logRequest(request)
+	sess, conn, err := requestSession(request)
+	httpUnauthorizedIf(response, request, err)
+	requestRole(response, request, sess, conn)
+
+	stats, err := game.GetStats(sess.GameID, conn)
+	httpInternalErrorIf(response, request, err)
+
+	result := statsResponse{
+		Game:    summarizeStats(game.TotalStats(stats)),
+		Players: make(map[id.UID]statsSummary, len(stats)),
+	}
+	lowestHitRate := 1.0
+	for playerID, playerStats := range stats {
+		summary := summarizeStats(playerStats)
+		result.Players[playerID] = summary
+		if playerStats.Dice != 0 && summary.HitRate <= lowestHitRate {
+			lowestHitRate = summary.HitRate
+			result.Unluckiest = playerID
+		}
+	}
+
+	err = writeBodyJSON(response, result)
+	httpInternalErrorIf(response, request, err)
+	httpSuccess(response, request, "Stats for ", len(stats), " players in ", sess.GameID)
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/gomodule/redigo/redis"
 	"sr/config"
+	"sr/export"
 	"sr/game"
 	"sr/id"
 	"sr/player"
@@ -33,25 +34,10 @@ func handleClearSessions(response Response, request *Request) {
 	conn := redisUtil.Connect()
 	defer closeRedis(request, conn)
 
-	keyNames, err := redis.Strings(conn.Do("keys", "session:*"))
+	removed, err := session.RemoveAll(conn)
 	httpInternalErrorIf(response, request, err)
-
-	httpInternalErrorIf(response, request,
-		conn.Send("MULTI"),
-	)
-	for _, keyName := range keyNames {
-		httpInternalErrorIf(response, request,
-			conn.Send("DEL", keyName),
-		)
-	}
-	results, err := redis.Ints(conn.Do("EXEC"))
-	httpInternalErrorIf(response, request, err)
-	if len(results) != len(keyNames) {
-		logf(request, "Expected %v results, got %v", len(keyNames), results)
-		httpInternalError(response, request, "Invalid response from redis")
-	}
 	httpSuccess(response, request,
-		"Deleted ", len(results), " sessions",
+		"Deleted ", removed, " sessions and indexes",
 	)
 }
 
@@ -188,6 +174,9 @@ func handleCreatePlayer(response Response, request *Request) {
 	logf(request, "Created %#v", plr)
 
 	err := player.Create(&plr, conn)
+	if errors.Is(err, player.ErrUsernameTaken) {
+		httpBadRequest(response, request, "Username `uname` is taken")
+	}
 	httpInternalErrorIf(response, request, err)
 	httpSuccess(response, request,
 		"Player ", plr.Username, " created with ID ", plr.ID,
@@ -207,6 +196,13 @@ func handleAddToGame(response Response, request *Request) {
 	if gameID == "" {
 		httpBadRequest(response, request, "GameID `game` not specified")
 	}
+	role := game.RolePlayer
+	if roleText := request.FormValue("role"); roleText != "" {
+		if !game.IsRole(roleText) {
+			httpBadRequest(response, request, "Invalid role `role`")
+		}
+		role = game.Role(roleText)
+	}
 
 	conn := redisUtil.Connect()
 	defer closeRedis(request, conn)
@@ -220,10 +216,99 @@ func handleAddToGame(response Response, request *Request) {
 	httpInternalErrorIf(response, request, err)
 	logf(request, "Found %#v", plr)
 
-	err = game.AddPlayer(gameID, plr, conn)
+	err = game.AddPlayer(gameID, plr, role, conn)
+	httpInternalErrorIf(response, request, err)
+	httpSuccess(response, request,
+		"Added ", plr, " to ", gameID, " as ", role,
+	)
+}
+
+var _ = tasksRouter.HandleFunc("/set-role", handleSetRoleTask).Methods("GET")
+
+// GET /task/set-role?game=&uname=&role= sets the role of a player already in a
+// game, i.e. to give a game which migrated without an owner a GM.
+func handleSetRoleTask(response Response, request *Request) {
+	logRequest(request)
+
+	username := request.FormValue("uname")
+	if username == "" {
+		httpBadRequest(response, request, "Username `uname` not specified")
+	}
+	gameID := request.FormValue("game")
+	if gameID == "" {
+		httpBadRequest(response, request, "GameID `game` not specified")
+	}
+	roleText := request.FormValue("role")
+	if !game.IsRole(roleText) {
+		httpBadRequest(response, request, "Invalid role `role`")
+	}
+	role := game.Role(roleText)
+
+	conn := redisUtil.Connect()
+	defer closeRedis(request, conn)
+
+	plr, err := player.GetByUsername(username, conn)
+	if errors.Is(err, player.ErrNotFound) {
+		httpBadRequest(response, request,
+			fmt.Sprintf("Player with username %v not found", username),
+		)
+	}
+	httpInternalErrorIf(response, request, err)
+
+	err = game.SetRole(gameID, plr.ID, role, conn)
+	if errors.Is(err, game.ErrNotInGame) {
+		httpBadRequest(response, request,
+			fmt.Sprintf("Player %v is not in %v", username, gameID),
+		)
+	}
+	httpInternalErrorIf(response, request, err)
+	httpSuccess(response, request,
+		"Set ", plr, " in ", gameID, " to ", role,
+	)
+}
+
+var _ = tasksRouter.HandleFunc("/import-events", handleImportEvents).Methods("POST")
+
+// POST /task/import-events ?gameID= multipart{events, mapping} -> import result
+func handleImportEvents(response Response, request *Request) {
+	logRequest(request)
+	gameID := request.FormValue("gameID")
+	if gameID == "" {
+		httpBadRequest(response, request, "GameID `gameID` not specified")
+	}
+
+	eventsFile, _, err := request.FormFile("events")
+	httpBadRequestIf(response, request, err)
+	defer eventsFile.Close()
+	mappingFile, _, err := request.FormFile("mapping")
+	httpBadRequestIf(response, request, err)
+	defer mappingFile.Close()
+	mapping, err := export.ReadPlayerMapping(mappingFile)
+	httpBadRequestIf(response, request, err)
+
+	conn := redisUtil.Connect()
+	defer closeRedis(request, conn)
+
+	if exists, err := game.Exists(gameID, conn); !exists {
+		httpInternalErrorIf(response, request, err)
+		httpBadRequest(response, request, "Game does not exist")
+	}
+
+	logf(request, "Importing events into %v with mapping %v", gameID, mapping)
+	result, err := export.Import(gameID, eventsFile, mapping, conn)
+	if errors.Is(err, export.ErrUnmappedPlayer) || errors.Is(err, game.ErrNotInGame) {
+		httpBadRequestIf(response, request, err)
+	}
+	httpInternalErrorIf(response, request, err)
+	if len(result.Collisions) != 0 {
+		logf(request, "Skipped colliding event IDs %v", result.Collisions)
+	}
+
+	err = writeBodyJSON(response, result)
 	httpInternalErrorIf(response, request, err)
 	httpSuccess(response, request,
-		"Added ", plr, " to ", gameID,
+		"Imported ", result.Imported, " events into ", gameID,
+		" (", len(result.Collisions), " collisions)",
 	)
 }
 
@@ -0,0 +1,156 @@
+package routes
+
+import (
+	"errors"
+	"sr/auth"
+	"sr/player"
+	"sr/session"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+type totpCodeRequest struct {
+	Code    string `json:"code"`
+	Current string `json:"current"`
+}
+
+// requireCurrentFactor forbids the request unless the code passes the
+// player's second factor.
+func requireCurrentFactor(response Response, request *Request, sess *session.Session, code string, conn redis.Conn) {
+	plr, err := sess.GetPlayer(conn)
+	httpInternalErrorIf(response, request, err)
+	err = auth.CheckSecondFactor(plr, code, conn)
+	if errors.Is(err, auth.ErrTooManyAttempts) {
+		httpTooManyRequests(response, request, "Too many attempts, try again later")
+	} else if errors.Is(err, auth.ErrNotAuthorized) {
+		httpForbidden(response, request, "Wrong code")
+	}
+	httpInternalErrorIf(response, request, err)
+}
+
+var _ = playerRouter.HandleFunc("/totp", handleGetTOTP).Methods("GET")
+
+// GET /player/totp -> { enabled, recoveryCodes }
+func handleGetTOTP(response Response, request *Request) {
+	logRequest(request)
+	sess, conn, err := requestSession(request)
+	httpUnauthorizedIf(response, request, err)
+	requirePlayerSession(response, request, sess)
+
+	enabled, err := player.HasTOTP(sess.PlayerID, conn)
+	httpInternalErrorIf(response, request, err)
+	codes, err := player.CountRecoveryCodes(sess.PlayerID, conn)
+	httpInternalErrorIf(response, request, err)
+
+	err = writeBodyJSON(response, map[string]interface{}{
+		"enabled": enabled, "recoveryCodes": codes,
+	})
+	httpInternalErrorIf(response, request, err)
+	httpSuccess(response, request, "TOTP enabled = ", enabled)
+}
+
+var _ = playerRouter.HandleFunc("/totp/enroll", handleEnrollTOTP).Methods("POST")
+
+// POST /player/totp/enroll -> { secret, uri }
+func handleEnrollTOTP(response Response, request *Request) {
+	logRequest(request)
+	sess, conn, err := requestSession(request)
+	httpUnauthorizedIf(response, request, err)
+	requirePlayerSession(response, request, sess)
+
+	secret, err := player.StartTOTPEnrollment(sess.PlayerID, conn)
+	httpInternalErrorIf(response, request, err)
+	logf(request, "%v started enrolling TOTP", sess.PlayerInfo())
+
+	err = writeBodyJSON(response, map[string]string{
+		"secret": secret, "uri": player.TOTPURI(secret, sess.Username),
+	})
+	httpInternalErrorIf(response, request, err)
+	httpSuccess(response, request, "TOTP enrollment for ", sess.PlayerID)
+}
+
+var _ = playerRouter.HandleFunc("/totp/confirm", handleConfirmTOTP).Methods("POST")
+
+// POST /player/totp/confirm { code, current } -> { recoveryCodes }
+func handleConfirmTOTP(response Response, request *Request) {
+	logRequest(request)
+	sess, conn, err := requestSession(request)
+	httpUnauthorizedIf(response, request, err)
+	requirePlayerSession(response, request, sess)
+
+	var confirm totpCodeRequest
+	err = readBodyJSON(request, &confirm)
+	httpBadRequestIf(response, request, err)
+
+	// Replacing an enabled secret needs the old one
+	enabled, err := player.HasTOTP(sess.PlayerID, conn)
+	httpInternalErrorIf(response, request, err)
+	if enabled {
+		requireCurrentFactor(response, request, sess, confirm.Current, conn)
+	}
+
+	codes, err := player.ConfirmTOTP(sess.PlayerID, confirm.Code, conn)
+	if errors.Is(err, player.ErrTOTPNotEnrolling) {
+		httpBadRequest(response, request, "Start enrolling first")
+	} else if errors.Is(err, player.ErrWrongCode) {
+		httpForbidden(response, request, "Wrong code")
+	}
+	httpInternalErrorIf(response, request, err)
+
+	err = writeBodyJSON(response, map[string][]string{"recoveryCodes": codes})
+	httpInternalErrorIf(response, request, err)
+	httpSuccess(response, request, "Enabled TOTP for ", sess.PlayerID)
+}
+
+var _ = playerRouter.HandleFunc("/totp/disable", handleDisableTOTP).Methods("POST")
+
+// POST /player/totp/disable { code } -> OK
+func handleDisableTOTP(response Response, request *Request) {
+	logRequest(request)
+	sess, conn, err := requestSession(request)
+	httpUnauthorizedIf(response, request, err)
+	requirePlayerSession(response, request, sess)
+
+	var disable totpCodeRequest
+	err = readBodyJSON(request, &disable)
+	httpBadRequestIf(response, request, err)
+
+	enabled, err := player.HasTOTP(sess.PlayerID, conn)
+	httpInternalErrorIf(response, request, err)
+	if !enabled {
+		httpSuccess(response, request, "(Idempotent, no changes made)")
+		return
+	}
+	requireCurrentFactor(response, request, sess, disable.Code, conn)
+
+	err = player.DisableTOTP(sess.PlayerID, conn)
+	httpInternalErrorIf(response, request, err)
+	httpSuccess(response, request, "Disabled TOTP for ", sess.PlayerID)
+}
+
+var _ = playerRouter.HandleFunc("/totp/recovery-codes", handleRegenerateRecoveryCodes).Methods("POST")
+
+// POST /player/totp/recovery-codes { code } -> { recoveryCodes }
+func handleRegenerateRecoveryCodes(response Response, request *Request) {
+	logRequest(request)
+	sess, conn, err := requestSession(request)
+	httpUnauthorizedIf(response, request, err)
+	requirePlayerSession(response, request, sess)
+
+	var regenerate totpCodeRequest
+	err = readBodyJSON(request, &regenerate)
+	httpBadRequestIf(response, request, err)
+
+	enabled, err := player.HasTOTP(sess.PlayerID, conn)
+	httpInternalErrorIf(response, request, err)
+	if !enabled {
+		httpBadRequest(response, request, "TOTP is not enabled")
+	}
+	requireCurrentFactor(response, request, sess, regenerate.Code, conn)
+
+	codes, err := player.GenerateRecoveryCodes(sess.PlayerID, conn)
+	httpInternalErrorIf(response, request, err)
+	err = writeBodyJSON(response, map[string][]string{"recoveryCodes": codes})
+	httpInternalErrorIf(response, request, err)
+	httpSuccess(response, request, "New recovery codes for ", sess.PlayerID)
+}
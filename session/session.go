@@ -1,12 +1,15 @@
 package session
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"github.com/gomodule/redigo/redis"
 	"sr/config"
 	"sr/id"
 	"sr/player"
+	"strings"
 	"time"
 )
 
@@ -20,12 +23,22 @@ import (
 // reading from a game subscription.
 //
 // Persistent sessions are set to expire with a longer-term TTL.
+//
+// Spectator sessions watch a game without a player. Their PlayerID is random
+// and not in the game, so they only see events shared with the game.
+//
+// Player sessions are indexed in `sessions:{playerID}` so players can see and
+// revoke them.
 type Session struct {
-	ID       id.UID `redis:"-"`
-	GameID   string `redis:"gameID"`
-	PlayerID id.UID `redis:"playerID"`
-	Persist  bool   `redis:"persist"`
-	Username string `redis:"username"`
+	ID        id.UID `redis:"-"`
+	GameID    string `redis:"gameID"`
+	PlayerID  id.UID `redis:"playerID"`
+	Persist   bool   `redis:"persist"`
+	Username  string `redis:"username"`
+	Spectator bool   `redis:"spectator"`
+	UserAgent string `redis:"userAgent"`
+	Created   int64  `redis:"created"`
+	LastSeen  int64  `redis:"lastSeen"`
 }
 
 // Type returns "persist" for persistent sessions and "temp" for temp sessions.
@@ -58,28 +71,77 @@ func (s *Session) redisKey() string {
 	return "session:" + string(s.ID)
 }
 
+func indexKey(playerID id.UID) string {
+	return "sessions:" + string(playerID)
+}
+
+// Handle identifies the session to its player without revealing its ID, which
+// would let anyone who sees it use the session.
+func (s *Session) Handle() string {
+	sum := sha256.Sum256([]byte(s.ID))
+	return hex.EncodeToString(sum[:8])
+}
+
+// CloseChannel is the channel which closes subscriptions using the session
+// when it is removed.
+func CloseChannel(sessionID id.UID) string {
+	return "close-session:" + string(sessionID)
+}
+
 // New makes a new session for the given player.
 // MakeSession adds a session for the given player in the given game
-func New(gameID string, player *player.Player, persist bool, conn redis.Conn) (*Session, error) {
+func New(gameID string, player *player.Player, persist bool, userAgent string, conn redis.Conn) (*Session, error) {
 	sessionID := id.GenSessionID()
+	now := id.TimestampNow()
 	session := Session{
-		ID:       sessionID,
-		GameID:   gameID,
-		PlayerID: player.ID,
-		Username: player.Username,
-		Persist:  persist,
+		ID:        sessionID,
+		GameID:    gameID,
+		PlayerID:  player.ID,
+		Username:  player.Username,
+		Persist:   persist,
+		UserAgent: userAgent,
+		Created:   now,
+		LastSeen:  now,
 	}
 
-	sessionArgs := redis.Args{}.Add(session.redisKey()).AddFlat(&session)
+	if err := session.create(conn); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// NewSpectator makes a new temporary session for watching the given game.
+func NewSpectator(gameID string, conn redis.Conn) (*Session, error) {
+	session := Session{
+		ID:        id.GenSessionID(),
+		GameID:    gameID,
+		PlayerID:  id.GenUID(),
+		Spectator: true,
+		Created:   id.TimestampNow(),
+	}
+	if err := session.create(conn); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (s *Session) create(conn redis.Conn) error {
+	sessionArgs := redis.Args{}.Add(s.redisKey()).AddFlat(s)
 	_, err := redis.String(conn.Do("hmset", sessionArgs...))
 	if err != nil {
-		return nil, fmt.Errorf("Redis error adding session %v: %w", sessionID, err)
+		return fmt.Errorf("Redis error adding session %v: %w", s.ID, err)
 	}
-	_, err = session.Expire(conn)
+	_, err = s.Expire(conn)
 	if err != nil {
-		return nil, fmt.Errorf("Redis error expiring session %v: %w", sessionID, err)
+		return fmt.Errorf("Redis error expiring session %v: %w", s.ID, err)
 	}
-	return &session, nil
+	if !s.Spectator {
+		_, err = conn.Do("ZADD", indexKey(s.PlayerID), s.LastSeen, s.ID)
+		if err != nil {
+			return fmt.Errorf("Redis error indexing session %v: %w", s.ID, err)
+		}
+	}
+	return nil
 }
 
 var errNilSession = errors.New("Nil sessionID requested")
@@ -123,18 +185,80 @@ func (s *Session) GetPlayer(conn redis.Conn) (*player.Player, error) {
 	return player.GetByID(string(s.PlayerID), conn)
 }
 
-// Remove removes a session from Redis.
+// Remove removes a session from Redis, and closes any subscriptions using it.
 func (s *Session) Remove(conn redis.Conn) error {
-	result, err := redis.Int(conn.Do("DEL", s.redisKey()))
-	if err != nil {
+	// MULTI: delete session, remove from index, close subscriptions
+	if err := conn.Send("MULTI"); err != nil {
+		return fmt.Errorf("sending redis MULTI: %w", err)
+	}
+	if err := conn.Send("DEL", s.redisKey()); err != nil {
 		return fmt.Errorf("sending redis DEL: %w", err)
 	}
-	if result != 1 {
-		return fmt.Errorf("expected 1 key deleted, got %v", result)
+	if err := conn.Send("ZREM", indexKey(s.PlayerID), s.ID); err != nil {
+		return fmt.Errorf("sending redis ZREM: %w", err)
+	}
+	if err := conn.Send("PUBLISH", CloseChannel(s.ID), "revoked"); err != nil {
+		return fmt.Errorf("sending redis PUBLISH: %w", err)
+	}
+	results, err := redis.Ints(conn.Do("EXEC"))
+	if err != nil {
+		return fmt.Errorf("sending redis EXEC: %w", err)
+	}
+	if len(results) != 3 || results[0] != 1 {
+		return fmt.Errorf("expected 1 key deleted, got %v", results)
+	}
+	return nil
+}
+
+// Touch records that the session was used, at most once a minute.
+func (s *Session) Touch(conn redis.Conn) error {
+	now := id.TimestampNow()
+	if now-s.LastSeen < int64(time.Minute/time.Millisecond) {
+		return nil
+	}
+	s.LastSeen = now
+
+	// MULTI: set last seen, update index
+	if err := conn.Send("MULTI"); err != nil {
+		return fmt.Errorf("sending redis MULTI: %w", err)
+	}
+	if err := conn.Send("HSET", s.redisKey(), "lastSeen", now); err != nil {
+		return fmt.Errorf("sending redis HSET: %w", err)
+	}
+	if !s.Spectator {
+		if err := conn.Send("ZADD", indexKey(s.PlayerID), "XX", now, s.ID); err != nil {
+			return fmt.Errorf("sending redis ZADD: %w", err)
+		}
+	}
+	if _, err := conn.Do("EXEC"); err != nil {
+		return fmt.Errorf("sending redis EXEC: %w", err)
 	}
 	return nil
 }
 
+// ListForPlayer retrieves a player's sessions, most recently seen first.
+// Expired sessions are removed from the index.
+func ListForPlayer(playerID id.UID, conn redis.Conn) ([]Session, error) {
+	sessionIDs, err := redis.Strings(conn.Do("ZREVRANGE", indexKey(playerID), 0, -1))
+	if err != nil {
+		return nil, fmt.Errorf("redis error getting sessions of %v: %w", playerID, err)
+	}
+	sessions := make([]Session, 0, len(sessionIDs))
+	for _, sessionID := range sessionIDs {
+		sess, err := GetByID(sessionID, conn)
+		if errors.Is(err, errNoSessionData) {
+			if _, err = conn.Do("ZREM", indexKey(playerID), sessionID); err != nil {
+				return nil, fmt.Errorf("redis error removing expired session: %w", err)
+			}
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *sess)
+	}
+	return sessions, nil
+}
+
 // Expire sets the session to expire in `config.SesssionExpirySecs`.
 func (s *Session) Expire(conn redis.Conn) (bool, error) {
 	ttl := config.TempSessionTTLSecs
@@ -150,3 +274,132 @@ func (s *Session) Expire(conn redis.Conn) (bool, error) {
 func (s *Session) Unexpire(conn redis.Conn) (bool, error) {
 	return redis.Bool(conn.Do("persist", s.redisKey()))
 }
+
+// RemoveForPlayer removes every session of a player in a game, returning how
+// many were removed.
+func RemoveForPlayer(gameID string, playerID id.UID, conn redis.Conn) (int, error) {
+	sessions, err := ListForPlayer(playerID, conn)
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, sess := range sessions {
+		if sess.GameID != gameID {
+			continue
+		}
+		if err = sess.Remove(conn); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// RemoveAllForPlayer removes every session of a player except the kept one,
+// returning how many were removed.
+func RemoveAllForPlayer(playerID id.UID, keep id.UID, conn redis.Conn) (int, error) {
+	sessions, err := ListForPlayer(playerID, conn)
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, sess := range sessions {
+		if sess.ID == keep {
+			continue
+		}
+		if err = sess.Remove(conn); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// migratedIndexKey is set once MigrateIndex has run, so it only scans once.
+const migratedIndexKey = "migrated:session-index"
+
+// MigrateIndex adds player sessions from before the session index to their
+// players' indexes. Sessions already indexed are unchanged. It only runs once.
+func MigrateIndex(conn redis.Conn) (int, error) {
+	migrated, err := redis.Bool(conn.Do("EXISTS", migratedIndexKey))
+	if err != nil {
+		return 0, fmt.Errorf("redis error checking session index migration: %w", err)
+	}
+	if migrated {
+		return 0, nil
+	}
+	indexed := 0
+	now := id.TimestampNow()
+	err = scanKeys("session:*", func(keys []string) error {
+		for _, key := range keys {
+			sess, err := GetByID(strings.TrimPrefix(key, "session:"), conn)
+			if errors.Is(err, errNoSessionData) {
+				continue
+			} else if err != nil {
+				return err
+			}
+			if sess.Spectator {
+				continue
+			}
+			added, err := redis.Int(conn.Do("ZADD", indexKey(sess.PlayerID), "NX", now, sess.ID))
+			if err != nil {
+				return fmt.Errorf("redis error indexing session %v: %w", sess.ID, err)
+			}
+			indexed += added
+		}
+		return nil
+	}, conn)
+	if err != nil {
+		return indexed, err
+	}
+	if _, err = conn.Do("SET", migratedIndexKey, id.TimestampNow()); err != nil {
+		return indexed, fmt.Errorf("redis error marking session index migrated: %w", err)
+	}
+	return indexed, nil
+}
+
+// RemoveAll deletes every session and player session index. It returns the
+// number of keys deleted.
+func RemoveAll(conn redis.Conn) (int, error) {
+	removed := 0
+	removeKeys := func(keys []string) error {
+		if len(keys) == 0 {
+			return nil
+		}
+		deleted, err := redis.Int(conn.Do("DEL", redis.Args{}.AddFlat(keys)...))
+		if err != nil {
+			return fmt.Errorf("redis error deleting sessions: %w", err)
+		}
+		removed += deleted
+		return nil
+	}
+	if err := scanKeys("session:*", removeKeys, conn); err != nil {
+		return removed, err
+	}
+	if err := scanKeys("sessions:*", removeKeys, conn); err != nil {
+		return removed, err
+	}
+	return removed, nil
+}
+
+// scanKeys calls each with the keys matching a pattern, a page at a time,
+// using SCAN so redis isn't blocked.
+func scanKeys(pattern string, each func(keys []string) error, conn redis.Conn) error {
+	cursor := 0
+	for {
+		values, err := redis.Values(conn.Do("SCAN", cursor, "MATCH", pattern, "COUNT", 100))
+		if err != nil {
+			return fmt.Errorf("redis error scanning %v: %w", pattern, err)
+		}
+		var keys []string
+		if _, err = redis.Scan(values, &cursor, &keys); err != nil {
+			return fmt.Errorf("redis error parsing scan of %v: %w", pattern, err)
+		}
+		if err = each(keys); err != nil {
+			return err
+		}
+		if cursor == 0 {
+			return nil
+		}
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"sr/game"
 	"sr/player"
 	redisUtil "sr/redis"
+	"sr/session"
 	"strings"
 )
 
@@ -20,6 +21,22 @@ func addHardcodedGames(conn redis.Conn) error {
 		gameKeys[i] = gameKey[5:]
 	}
 	log.Printf("Games (%v): %v", len(gameKeys), gameKeys)
+	for _, gameID := range gameKeys {
+		migrated, err := game.MigrateRoles(gameID, conn)
+		if err != nil {
+			return fmt.Errorf("migrating roles in %v: %w", gameID, err)
+		}
+		if migrated {
+			log.Printf("Migrated players in %v to roles", gameID)
+		}
+		indexed, err := game.IndexPlayerGames(gameID, conn)
+		if err != nil {
+			return fmt.Errorf("indexing players in %v: %w", gameID, err)
+		}
+		if indexed != 0 {
+			log.Printf("Indexed %v players in %v", indexed, gameID)
+		}
+	}
 	if !config.IsProduction && len(gameKeys) < len(config.HardcodedGameNames) {
 		log.Printf("Creating games %v", config.HardcodedGameNames)
 		for i, game := range config.HardcodedGameNames {
@@ -60,14 +77,19 @@ func addHardcodedPlayers(conn redis.Conn) error {
 	if !config.IsProduction && len(players) < len(config.HardcodedUsernames) {
 		log.Printf("Adding %v to all games", config.HardcodedUsernames)
 		games := config.HardcodedGameNames
-		for _, username := range config.HardcodedUsernames {
+		for i, username := range config.HardcodedUsernames {
 			plr := player.Make(username, strings.Title(username))
 			err := player.Create(&plr, conn)
 			if err != nil {
 				return fmt.Errorf("creating %v: %w", username, err)
 			}
+			// The first player is the GM of the dev games
+			role := game.RolePlayer
+			if i == 0 {
+				role = game.RoleGM
+			}
 			for _, gameID := range games {
-				err := game.AddPlayer(gameID, &plr, conn)
+				err := game.AddPlayer(gameID, &plr, role, conn)
 				if err != nil {
 					return fmt.Errorf("adding %v to %v: %w", username, gameID)
 				}
@@ -89,4 +111,11 @@ func CheckGamesAndPlayers() {
 	if err := addHardcodedPlayers(conn); err != nil {
 		panic(fmt.Errorf("Error adding hardcoded players: %w", err))
 	}
+	indexed, err := session.MigrateIndex(conn)
+	if err != nil {
+		panic(fmt.Errorf("Error indexing sessions: %w", err))
+	}
+	if indexed != 0 {
+		log.Printf("Indexed %v sessions", indexed)
+	}
 }
@@ -45,52 +45,3 @@ func streamReadEvents(gameID string, callback func([]event.Event, int) error, co
 	}
 	return nil
 }
-
-func printEvent(evt event.Event) string {
-	switch evt.(type) {
-	case *event.Roll:
-		roll := evt.(*event.Roll)
-		if roll.Title != "" {
-			return fmt.Sprintf("%v rolls %v dice to %v",
-				roll.PlayerName, len(roll.Dice), roll.Title,
-			)
-		}
-		return fmt.Sprintf("%v rolls %v dice",
-			roll.PlayerName, len(roll.Dice))
-	case *event.EdgeRoll:
-		edgeRoll := evt.(*event.EdgeRoll)
-		if edgeRoll.Title != "" {
-			return fmt.Sprintf("%v edge rolls %v rounds to %v",
-				edgeRoll.PlayerName, len(edgeRoll.Rounds), edgeRoll.Title,
-			)
-		}
-		return fmt.Sprintf("%v edge rolls %v rounds",
-			edgeRoll.PlayerName, len(edgeRoll.Rounds))
-	case *event.Reroll:
-		reroll := evt.(*event.Reroll)
-		if reroll.Title != "" {
-			return fmt.Sprintf("%v rerolls %v dice to %v",
-				reroll.PlayerName, len(reroll.Rounds[1]), reroll.Title,
-			)
-		}
-		return fmt.Sprintf("%v rerolls %v dice",
-			reroll.PlayerName, len(reroll.Rounds[1]),
-		)
-	case *event.InitiativeRoll:
-		initRoll := evt.(*event.InitiativeRoll)
-		title := "initiative"
-		if initRoll.Title != "" {
-			title = initRoll.Title
-		}
-		return fmt.Sprintf("%v rolls %v + %vd6 for %v",
-			initRoll.PlayerName, initRoll.Base, initRoll.Dice, title,
-		)
-	case *event.PlayerJoin:
-		join := evt.(*event.PlayerJoin)
-		return fmt.Sprintf("%v joined <game>.",
-			join.PlayerName,
-		)
-	default:
-		return fmt.Sprintf("Unknown %#v", evt)
-	}
-}
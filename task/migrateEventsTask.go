@@ -7,6 +7,7 @@ import (
 	"os"
 	"reflect"
 	"sr/event"
+	"sr/export"
 	"sr/game"
 	"sr/id"
 	"sr/player"
@@ -64,7 +65,7 @@ func handleGameMigrationTask(gameID string, conn redis.Conn) error {
 			// Get existing data from event
 			eventPlayerID := evt.GetPlayerID()
 			eventPlayerName := evt.GetPlayerName()
-			log.Printf("> %v <", printEvent(evt))
+			log.Printf("> %v <", export.PrintEvent(evt))
 			var migratedPlayerID id.UID = func() id.UID {
 				// If we already have a known player, set them
 				if foundID, found := migratedPlayers[eventPlayerID]; found {
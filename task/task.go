@@ -3,13 +3,14 @@ package task
 import (
 	"log"
 	"os"
+	"sr/export"
 	"sr/game"
 	redisUtil "sr/redis"
 )
 
 // PrintAvailableTasks prints the list of CLI tasks
 func PrintAvailableTasks() {
-	tasks := []string{"migrate"}
+	tasks := []string{"migrate", "export", "import", "stats", "ppr"}
 	log.Printf("Available tasks:\n\t%v", tasks)
 }
 
@@ -34,6 +35,96 @@ func RunSelectedTask(task string, args []string) {
 			os.Exit(1)
 		}
 		break
+	case "export":
+		if len(args) < 2 || len(args) > 3 {
+			log.Print("Usage: export <gameID> <json|csv|md> [file]")
+			os.Exit(1)
+		}
+		gameID := args[0]
+		format, ok := export.ParseFormat(args[1])
+		if !ok {
+			log.Printf("Unknown export format %v", args[1])
+			os.Exit(1)
+		}
+		out := os.Stdout
+		if len(args) == 3 {
+			file, err := os.Create(args[2])
+			if err != nil {
+				log.Printf("Unable to create %v: %v", args[2], err)
+				os.Exit(1)
+			}
+			defer file.Close()
+			out = file
+		}
+		conn := redisUtil.Connect()
+		defer redisUtil.Close(conn)
+		if ok, err := game.Exists(gameID, conn); !ok || err != nil {
+			log.Printf("Game %v does not exist (%v)", gameID, err)
+			os.Exit(1)
+		}
+		if err := export.Game(gameID, format, out, nil, conn); err != nil {
+			log.Printf("Error with task: %v", err)
+			os.Exit(1)
+		}
+		break
+	case "import":
+		if len(args) != 3 {
+			log.Print("Usage: import <gameID> <events.jsonl> <mapping.json>")
+			os.Exit(1)
+		}
+		gameID := args[0]
+		eventsFile, err := os.Open(args[1])
+		if err != nil {
+			log.Printf("Unable to open %v: %v", args[1], err)
+			os.Exit(1)
+		}
+		defer eventsFile.Close()
+		mappingFile, err := os.Open(args[2])
+		if err != nil {
+			log.Printf("Unable to open %v: %v", args[2], err)
+			os.Exit(1)
+		}
+		defer mappingFile.Close()
+		mapping, err := export.ReadPlayerMapping(mappingFile)
+		if err != nil {
+			log.Printf("Invalid mapping file: %v", err)
+			os.Exit(1)
+		}
+		conn := redisUtil.Connect()
+		defer redisUtil.Close(conn)
+		if ok, err := game.Exists(gameID, conn); !ok || err != nil {
+			log.Printf("Game %v does not exist (%v)", gameID, err)
+			os.Exit(1)
+		}
+		result, err := export.Import(gameID, eventsFile, mapping, conn)
+		if err != nil {
+			log.Printf("Error with task: %v", err)
+			os.Exit(1)
+		}
+		log.Printf("Imported %v events into %v", result.Imported, gameID)
+		if len(result.Collisions) != 0 {
+			log.Printf("Skipped %v colliding event IDs: %v",
+				len(result.Collisions), result.Collisions,
+			)
+		}
+		break
+	case "stats":
+		if len(args) != 1 {
+			log.Print("Usage: stats <gameID>")
+			os.Exit(1)
+		}
+		gameID := args[0]
+		conn := redisUtil.Connect()
+		defer redisUtil.Close(conn)
+		if ok, err := game.Exists(gameID, conn); !ok || err != nil {
+			log.Printf("Game %v does not exist (%v)", gameID, err)
+			os.Exit(1)
+		}
+		if err := game.RebuildStats(gameID, conn); err != nil {
+			log.Printf("Error with task: %v", err)
+			os.Exit(1)
+		}
+		break
 	case "ppr": // post prerender
 		if len(args) != 2 {
 			log.Print("Usage: ppr <src> <dest>")
@@ -60,6 +60,17 @@ func ForEventDiff(event event.Event, diff map[string]interface{}) Event {
 	}
 }
 
+// ForEventRevision constructs an update for an edit which saved the previous
+// version of an event. The diff is sent with the event's new revision count.
+func ForEventRevision(event event.Event, diff map[string]interface{}) Event {
+	update := makeEventDiff(event)
+	for key, value := range diff {
+		update.diff[key] = value
+	}
+	update.diff["revs"] = event.GetRevs()
+	return &update
+}
+
 // ForEventRename constructs an update for renaming an event
 func ForEventRename(event event.Event, newTitle string) Event {
 	update := makeEventDiff(event)
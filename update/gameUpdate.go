@@ -0,0 +1,41 @@
+package update
+
+import (
+	"encoding/json"
+)
+
+// Game is the interface for updates to a game's info
+type Game interface {
+	Update
+}
+
+// gameDiff updates fields of a game's info.
+type gameDiff struct {
+	diff map[string]interface{}
+}
+
+// Type gets the type of the update
+func (update *gameDiff) Type() string {
+	return UpdateTypeGame
+}
+
+// MarshalJSON converts the update to JSON.
+func (update *gameDiff) MarshalJSON() ([]byte, error) {
+	fields := []interface{}{UpdateTypeGame, update.diff}
+	return json.Marshal(fields)
+}
+
+// ForGameDiff constructs an update for a game's info changing
+func ForGameDiff(diff map[string]interface{}) Game {
+	return &gameDiff{diff: diff}
+}
+
+// ForGamePins constructs an update for the pinned events of a game changing
+func ForGamePins(pins []int64) Game {
+	return ForGameDiff(map[string]interface{}{"pins": pins})
+}
+
+// ForBookmarks constructs an update for a player's bookmarks changing
+func ForBookmarks(bookmarks []int64) Game {
+	return ForGameDiff(map[string]interface{}{"bookmarks": bookmarks})
+}
@@ -116,3 +116,33 @@ func (update *playerAdd) MakeRedisCommand() (string, redis.Args) {
 func ForPlayerAdd(player *player.Player) Player {
 	return &playerAdd{player}
 }
+
+type playerRemove struct {
+	id id.UID
+}
+
+func (update *playerRemove) Type() string {
+	return UpdateTypePlayer
+}
+
+func (update *playerRemove) PlayerID() id.UID {
+	return update.id
+}
+
+func (update *playerRemove) IsEmpty() bool {
+	return false
+}
+
+func (update *playerRemove) MarshalJSON() ([]byte, error) {
+	fields := []interface{}{UpdateTypePlayer, "del", update.id}
+	return json.Marshal(fields)
+}
+
+func (update *playerRemove) MakeRedisCommand() (string, redis.Args) {
+	panic("MakeRedisCommand called on update.playerRemove")
+}
+
+// ForPlayerRemove constructs an update for removing a player from a game
+func ForPlayerRemove(playerID id.UID) Player {
+	return &playerRemove{playerID}
+}
@@ -11,6 +11,9 @@ const UpdateTypeEvent = "evt"
 // UpdateTypePlayer is the "type" field that's set for player updates
 const UpdateTypePlayer = "plr"
 
+// UpdateTypeGame is the "type" field that's set for game updates
+const UpdateTypeGame = "game"
+
 // Update is the basic interface for update structs
 type Update interface {
 	json.Marshaler